@@ -63,6 +63,7 @@ const (
 	optionNameFullNode                   = "full-node"
 	optionNamePostageContractAddress     = "postage-stamp-address"
 	optionNameBlockTime                  = "block-time"
+	optionNamePushSyncPutQueue           = "pushsync-put-queue"
 )
 
 func init() {
@@ -234,6 +235,7 @@ func (c *command) setAllFlags(cmd *cobra.Command) {
 	cmd.Flags().String(optionNamePostageContractAddress, "", "postage stamp contract address")
 	cmd.Flags().String(optionNameTransactionHash, "", "proof-of-identity transaction hash")
 	cmd.Flags().Uint64(optionNameBlockTime, 15, "chain block time")
+	cmd.Flags().Int(optionNamePushSyncPutQueue, 0, "depth of the queue for storing pushed chunks in the background, 0 stores them before the receipt is sent")
 }
 
 func newLogger(cmd *cobra.Command, verbosity string) (logging.Logger, error) {
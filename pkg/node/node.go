@@ -88,6 +88,7 @@ type Bee struct {
 	pusherCloser             io.Closer
 	pullerCloser             io.Closer
 	pullSyncCloser           io.Closer
+	pushSyncCloser           io.Closer
 	pssCloser                io.Closer
 	ethClientCloser          func()
 	transactionMonitorCloser io.Closer
@@ -134,6 +135,7 @@ type Options struct {
 	PostageContractAddress     string
 	PriceOracleAddress         string
 	BlockTime                  uint64
+	PushSyncPutQueue           int
 }
 
 const (
@@ -540,7 +542,12 @@ func NewBee(addr string, swarmAddress swarm.Address, publicKey ecdsa.PublicKey,
 
 	pinningService := pinning.NewService(storer, stateStore, traversalService)
 
-	pushSyncProtocol := pushsync.New(swarmAddress, p2ps, storer, kad, tagService, o.FullNodeMode, pssService.TryUnwrap, validStamp, logger, acc, pricer, signer, tracer)
+	pushSyncProtocol := pushsync.New(swarmAddress, p2ps, storer, kad, tagService, o.FullNodeMode, pssService.TryUnwrap, validStamp, logger, acc, pricer, signer, tracer, pushsync.WithReceiptVerification(networkID), pushsync.WithStorePutQueue(o.PushSyncPutQueue), pushsync.WithWriteAheadLog(pushsync.NewStateStoreWAL(stateStore)))
+
+	b.pushSyncCloser = pushSyncProtocol
+
+	// drop the cached prices of peers that announce their pricing terms
+	pricing.SetPeerPriceObserver(pushSyncProtocol)
 
 	// set the pushSyncer in the PSS
 	pssService.SetPushSyncer(pushSyncProtocol)
@@ -563,7 +570,7 @@ func NewBee(addr string, swarmAddress swarm.Address, publicKey ecdsa.PublicKey,
 	b.pullerCloser = pullerService
 
 	retrieveProtocolSpec := retrieve.Protocol()
-	pushSyncProtocolSpec := pushSyncProtocol.Protocol()
+	pushSyncProtocolSpecs := pushSyncProtocol.Protocols()
 	pullSyncProtocolSpec := pullSyncProtocol.Protocol()
 
 	if o.FullNodeMode {
@@ -571,15 +578,19 @@ func NewBee(addr string, swarmAddress swarm.Address, publicKey ecdsa.PublicKey,
 	} else {
 		logger.Info("starting in light mode")
 		p2p.WithBlocklistStreams(p2p.DefaultBlocklistTime, retrieveProtocolSpec)
-		p2p.WithBlocklistStreams(p2p.DefaultBlocklistTime, pushSyncProtocolSpec)
+		for _, spec := range pushSyncProtocolSpecs {
+			p2p.WithBlocklistStreams(p2p.DefaultBlocklistTime, spec)
+		}
 		p2p.WithBlocklistStreams(p2p.DefaultBlocklistTime, pullSyncProtocolSpec)
 	}
 
 	if err = p2ps.AddProtocol(retrieveProtocolSpec); err != nil {
 		return nil, fmt.Errorf("retrieval service: %w", err)
 	}
-	if err = p2ps.AddProtocol(pushSyncProtocolSpec); err != nil {
-		return nil, fmt.Errorf("pushsync service: %w", err)
+	for _, spec := range pushSyncProtocolSpecs {
+		if err = p2ps.AddProtocol(spec); err != nil {
+			return nil, fmt.Errorf("pushsync service: %w", err)
+		}
 	}
 	if err = p2ps.AddProtocol(pullSyncProtocolSpec); err != nil {
 		return nil, fmt.Errorf("pullsync protocol: %w", err)
@@ -718,6 +729,10 @@ func (b *Bee) Shutdown(ctx context.Context) error {
 		errs.add(fmt.Errorf("pull sync: %w", err))
 	}
 
+	if err := b.pushSyncCloser.Close(); err != nil {
+		errs.add(fmt.Errorf("push sync: %w", err))
+	}
+
 	if err := b.pssCloser.Close(); err != nil {
 		errs.add(fmt.Errorf("pss: %w", err))
 	}
@@ -0,0 +1,98 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protobuf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+	ggio "github.com/gogo/protobuf/io"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+// snappyMagic is the stream identifier that starts every snappy framed
+// stream. A delimited protobuf stream can not start with it, as the byte
+// that follows the length prefix would be an invalid field tag.
+var snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+
+// NewCompressedWriterAndReader is like NewWriterAndReader, but messages are
+// compressed with snappy framing before being written to the stream. Both
+// sides of the stream need to agree on using compression, but the reader
+// also accepts messages written by a writer without compression.
+func NewCompressedWriterAndReader(s p2p.Stream) (Writer, Reader) {
+	return NewCompressedWriter(s), NewCompressedReader(s)
+}
+
+// NewCompressedWriter returns a writer that compresses messages with snappy
+// framing. Every message is flushed to w once it is written.
+func NewCompressedWriter(w io.Writer) Writer {
+	sw := snappy.NewBufferedWriter(w)
+	return newWriter(flushingWriter{
+		Writer:  ggio.NewDelimitedWriter(sw),
+		flusher: sw,
+	})
+}
+
+// NewCompressedReader returns a reader of messages compressed with snappy
+// framing. If the data in r is not compressed, messages are read from it as
+// with NewReader.
+func NewCompressedReader(r io.Reader) Reader {
+	return newReader(ggio.NewDelimitedReader(&decompressingReader{r: bufio.NewReader(r)}, defaultMaxMessageSize()), r)
+}
+
+type flushingWriter struct {
+	ggio.Writer
+	flusher interface{ Flush() error }
+}
+
+func (w flushingWriter) WriteMsg(msg proto.Message) error {
+	if err := w.Writer.WriteMsg(msg); err != nil {
+		return err
+	}
+	return w.flusher.Flush()
+}
+
+// decompressingReader detects on the first read if the underlying data is
+// snappy framed and decompresses it if it is.
+type decompressingReader struct {
+	r      *bufio.Reader
+	reader io.Reader
+}
+
+func (d *decompressingReader) Read(p []byte) (n int, err error) {
+	if d.reader == nil {
+		compressed, err := d.isCompressed()
+		if err != nil {
+			return 0, err
+		}
+		if compressed {
+			d.reader = snappy.NewReader(d.r)
+		} else {
+			d.reader = d.r
+		}
+	}
+	return d.reader.Read(p)
+}
+
+func (d *decompressingReader) isCompressed() (bool, error) {
+	// Only peek the whole identifier if the first byte matches. A
+	// non-compressed message that starts with the same byte is long enough
+	// for the peek not to block.
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	if b[0] != snappyMagic[0] {
+		return false, nil
+	}
+	b, err = d.r.Peek(len(snappyMagic))
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return bytes.Equal(b, snappyMagic), nil
+}
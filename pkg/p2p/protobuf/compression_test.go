@@ -0,0 +1,76 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protobuf_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/p2p/protobuf"
+	"github.com/ethersphere/bee/pkg/p2p/protobuf/internal/pb"
+)
+
+func TestCompressedWriterAndReader(t *testing.T) {
+	messages := []string{"first", "second", strings.Repeat("third", 1000)}
+
+	for _, tc := range []struct {
+		name       string
+		writerFunc func(w io.Writer) protobuf.Writer
+	}{
+		{
+			name: "compressed",
+			writerFunc: func(w io.Writer) protobuf.Writer {
+				writer, _ := protobuf.NewCompressedWriterAndReader(newNoopReadCloser(w))
+				return writer
+			},
+		},
+		{
+			name:       "not compressed",
+			writerFunc: protobuf.NewWriter,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := tc.writerFunc(&buf)
+			for _, m := range messages {
+				if err := w.WriteMsg(&pb.Message{Text: m}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, r := protobuf.NewCompressedWriterAndReader(newNoopWriteCloser(&buf))
+			var msg pb.Message
+			for _, m := range messages {
+				if err := r.ReadMsg(&msg); err != nil {
+					t.Fatal(err)
+				}
+				if msg.Text != m {
+					t.Errorf("got message %q, want %q", msg.Text, m)
+				}
+			}
+			if err := r.ReadMsg(&msg); err != io.EOF {
+				t.Fatalf("got error %v, want %v", err, io.EOF)
+			}
+		})
+	}
+}
+
+func TestCompressedWriter_size(t *testing.T) {
+	msg := &pb.Message{Text: strings.Repeat("text", 1000)}
+
+	var plain, compressed bytes.Buffer
+	if err := protobuf.NewWriter(&plain).WriteMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := protobuf.NewCompressedWriter(&compressed).WriteMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if compressed.Len() >= plain.Len() {
+		t.Errorf("got compressed size %v, want less than %v", compressed.Len(), plain.Len())
+	}
+}
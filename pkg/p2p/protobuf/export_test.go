@@ -0,0 +1,14 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protobuf
+
+import "sync/atomic"
+
+// ResetDefaultMaxMessageSize restores the default maximum message size, so
+// that it can be set again.
+func ResetDefaultMaxMessageSize() {
+	atomic.StoreInt64(&maxMessageSize, delimitedReaderMaxSize)
+	atomic.StoreInt32(&maxMessageSizeSet, 0)
+}
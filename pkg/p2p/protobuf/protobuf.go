@@ -5,57 +5,380 @@
 package protobuf
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ethersphere/bee/pkg/p2p"
 	ggio "github.com/gogo/protobuf/io"
 	"github.com/gogo/protobuf/proto"
 )
 
+// DefaultMaxMessageSize is the maximum size of a message that readers
+// created with NewReader and NewWriterAndReader accept, unless it is changed
+// with SetDefaultMaxMessageSize.
+const DefaultMaxMessageSize = delimitedReaderMaxSize
+
 const delimitedReaderMaxSize = 128 * 1024 // max message size
 
+var (
+	maxMessageSize    int64 = delimitedReaderMaxSize
+	maxMessageSizeSet int32
+)
+
 var ErrTimeout = errors.New("timeout")
 
+// ErrMaxMessageSizeSet is returned by SetDefaultMaxMessageSize if the default
+// maximum message size was already set.
+var ErrMaxMessageSizeSet = errors.New("default max message size already set")
+
+// SetDefaultMaxMessageSize sets the maximum size of a message that readers
+// accept by default to size bytes, instead of DefaultMaxMessageSize. It is
+// meant to be called once on initialization and returns ErrMaxMessageSizeSet
+// on subsequent calls. Readers keep the maximum size they were created with,
+// so setting it while streams are handled only affects the readers created
+// afterwards.
+func SetDefaultMaxMessageSize(size int) error {
+	if size < 1 {
+		return fmt.Errorf("invalid max message size %d", size)
+	}
+	if !atomic.CompareAndSwapInt32(&maxMessageSizeSet, 0, 1) {
+		return ErrMaxMessageSizeSet
+	}
+	atomic.StoreInt64(&maxMessageSize, int64(size))
+	return nil
+}
+
+// defaultMaxMessageSize returns the maximum size of a message that readers
+// accept by default.
+func defaultMaxMessageSize() int {
+	return int(atomic.LoadInt64(&maxMessageSize))
+}
+
+// ErrStreamTooLarge is returned by readers created with NewLimitedReader when
+// more data than their limit is read.
+var ErrStreamTooLarge = errors.New("stream too large")
+
+// ErrUnexpectedMessageType is returned by ReadMsgTyped if the read message is
+// not of the expected type.
+var ErrUnexpectedMessageType = errors.New("unexpected message type")
+
 type Message = proto.Message
 
 func NewWriterAndReader(s p2p.Stream) (Writer, Reader) {
-	return NewWriter(s), NewReader(s)
+	return NewWriterAndReaderWithMaxSize(s, defaultMaxMessageSize())
+}
+
+// NewWriterAndReaderWithMaxSize is like NewWriterAndReader, but the reader
+// accepts messages of up to max bytes.
+func NewWriterAndReaderWithMaxSize(s p2p.Stream, max int) (Writer, Reader) {
+	return NewWriter(s), NewReaderWithMaxSize(s, max)
 }
 
 func NewReader(r io.Reader) Reader {
-	return newReader(ggio.NewDelimitedReader(r, delimitedReaderMaxSize))
+	return NewReaderWithMaxSize(r, defaultMaxMessageSize())
+}
+
+// NewReaderWithMaxSize is like NewReader, but accepts messages of up to max
+// bytes instead of the default maximum message size.
+func NewReaderWithMaxSize(r io.Reader, max int) Reader {
+	return newReader(ggio.NewDelimitedReader(r, max), r)
+}
+
+// NewReaderNamed is like NewReader, but errors from reading messages, other
+// than io.EOF, include typeName as the name of the expected message type.
+func NewReaderNamed(r io.Reader, typeName string) Reader {
+	pr := NewReader(r)
+	pr.typeName = typeName
+	return pr
+}
+
+// NewDeadlineReader is like NewReader, but ReadMsgWithContext sets the read
+// deadline of the stream to the deadline of the context before every read,
+// so that reads return in time even on streams that do not return when the
+// context is done. If the stream has no SetReadDeadline method, it is the
+// same as NewReader.
+func NewDeadlineReader(s p2p.Stream) Reader {
+	r := NewReader(s)
+	r.contextDeadlines = r.deadliner != nil
+	return r
+}
+
+// NewPooledReader is like NewReader, but the buffers that messages are read
+// into are taken from a pool shared by all pooled readers, instead of being
+// allocated for every reader. It is suitable for hot paths where many short
+// lived streams are read.
+func NewPooledReader(r io.Reader) Reader {
+	return newReader(&pooledReader{r: bufio.NewReader(r), maxSize: defaultMaxMessageSize()}, r)
+}
+
+// NewCountingWriterAndReader is like NewWriterAndReader, but it also returns
+// Counters with the number of bytes written to and read from the stream.
+func NewCountingWriterAndReader(s p2p.Stream) (Writer, Reader, *Counters) {
+	c := new(Counters)
+	w := NewWriter(countingWriter{w: s, c: c})
+	r := newReader(ggio.NewDelimitedReader(countingReader{r: s, c: c}, defaultMaxMessageSize()), s)
+	return w, r, c
 }
 
 func NewWriter(w io.Writer) Writer {
 	return newWriter(ggio.NewDelimitedWriter(w))
 }
 
+// NewBufferedWriter returns a writer that buffers messages in a buffer of
+// bufSize bytes, together with the function that flushes the buffered
+// messages to w. Messages are only written to w once the buffer is full or
+// flush is called, so flush has to be called before waiting for a response
+// to the written messages. Values of bufSize lower than 1 result in the
+// default buffer size of the bufio package. The writer and the flush function
+// must not be used concurrently.
+func NewBufferedWriter(w io.Writer, bufSize int) (Writer, func() error) {
+	bw := bufio.NewWriterSize(w, bufSize)
+	return newWriter(ggio.NewDelimitedWriter(bw)), bw.Flush
+}
+
+// ReadMessages reads messages from r until io.EOF. If reading fails before
+// that, the messages read before the failure are returned together with the
+// error, so that callers can still process them.
 func ReadMessages(r io.Reader, newMessage func() Message) (m []Message, err error) {
+	err = RangeMessages(r, newMessage, func(msg Message) error {
+		m = append(m, msg)
+		return nil
+	})
+	return m, err
+}
+
+// RangeMessages reads messages from r until io.EOF and calls fn for each of
+// them, without holding them in memory. It stops early if fn returns an error,
+// which is returned, unless it is io.EOF, in which case nil is returned.
+func RangeMessages(r io.Reader, newMessage func() Message, fn func(Message) error) error {
 	pr := NewReader(r)
 	for {
 		msg := newMessage()
 		if err := pr.ReadMsg(msg); err != nil {
 			if err == io.EOF {
-				break
+				return nil
+			}
+			return err
+		}
+		if err := fn(msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// WriteMessages writes all messages to w. It stops on the first failed write
+// and returns its error annotated with the index of the message.
+func WriteMessages(w io.Writer, msgs []Message) error {
+	pw := NewWriter(w)
+	for i, msg := range msgs {
+		if err := pw.WriteMsg(msg); err != nil {
+			return fmt.Errorf("write message %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// DecodeMessage decodes a single length delimited message from data into msg,
+// the same way as the reader returned by NewReader reads it from a stream.
+// Messages larger than the default maximum message size are rejected with
+// io.ErrShortBuffer and truncated data results in io.ErrUnexpectedEOF. Any
+// data after the message is ignored.
+func DecodeMessage(data []byte, msg Message) error {
+	return ggio.NewDelimitedReader(bytes.NewReader(data), defaultMaxMessageSize()).ReadMsg(msg)
+}
+
+// ReadMsgTyped reads the next message from r into msg and checks that the
+// registered protobuf name of msg, such as "pushsync.Delivery", is
+// expectedName. It returns an error matching ErrUnexpectedMessageType
+// otherwise. The check is on the type that the caller decodes into, so it
+// catches code that reads a protocol version with the wrong message type. It
+// does not detect that the peer sent a message of another type, as the type
+// of a message is not encoded on the wire and protobuf decoding skips unknown
+// fields.
+func ReadMsgTyped(r ggio.Reader, msg Message, expectedName string) error {
+	if err := r.ReadMsg(msg); err != nil {
+		return err
+	}
+	if name := proto.MessageName(msg); name != expectedName {
+		return fmt.Errorf("got %q message, want %q: %w", name, expectedName, ErrUnexpectedMessageType)
+	}
+	return nil
+}
+
+// ReadRawFrame reads a single length delimited frame from r and returns its
+// payload without decoding it, so that it can be forwarded verbatim with
+// WriteRawFrame. Frames larger than the default maximum message size are
+// rejected with io.ErrShortBuffer. It reads no data from r beyond the frame,
+// so it can be called repeatedly on the same stream.
+func ReadRawFrame(r io.Reader) ([]byte, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = singleByteReader{r: r}
+	}
+	length64, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if length64 > uint64(defaultMaxMessageSize()) {
+		return nil, io.ErrShortBuffer
+	}
+
+	data := make([]byte, length64)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteRawFrame writes data to w as a single length delimited frame, the same
+// way as writers write encoded messages.
+func WriteRawFrame(w io.Writer, data []byte) error {
+	frame := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data))
+	n := binary.PutUvarint(frame, uint64(len(data)))
+	_, err := w.Write(append(frame[:n], data...))
+	return err
+}
+
+// WriteGroupEnd writes the end of a group of messages to w, so that the
+// reader of the group can tell where it ends while the stream stays open for
+// other data. The end of a group is encoded as a frame of length zero, which
+// is the single byte 0x00. Messages with an empty encoding, which have only
+// fields with default values, are encoded the same way, so they can not be
+// written in a group.
+func WriteGroupEnd(w io.Writer) error {
+	return WriteRawFrame(w, nil)
+}
+
+// ReadGroup reads messages from r until the end of the group written with
+// WriteGroupEnd, which is consumed. It reads no data from r beyond the end of
+// the group. If r ends before the end of the group, io.ErrUnexpectedEOF is
+// returned.
+func ReadGroup(r io.Reader, newMessage func() Message) ([]Message, error) {
+	var m []Message
+	for {
+		frame, err := ReadRawFrame(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
 			}
 			return nil, err
 		}
+		if len(frame) == 0 {
+			return m, nil
+		}
+		msg := newMessage()
+		if err := proto.Unmarshal(frame, msg); err != nil {
+			return nil, err
+		}
+		m = append(m, msg)
+	}
+}
+
+// singleByteReader reads the length prefix of a frame one byte at a time, so
+// that no data after the prefix is consumed from the underlying reader.
+type singleByteReader struct {
+	r io.Reader
+}
+
+func (r singleByteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r.r, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// ReadMessagesWithContext is like ReadMessages, but returns when the context
+// is done. If r has a SetReadDeadline method, the context deadline is also
+// applied to r so that reads blocked on it return in time, and it is cleared
+// on return. On error, the messages read so far are returned with it.
+func ReadMessagesWithContext(ctx context.Context, r io.Reader, newMessage func() Message) (m []Message, err error) {
+	if d, ok := r.(readDeadliner); ok {
+		if deadline, ok := ctx.Deadline(); ok {
+			if err := d.SetReadDeadline(deadline); err != nil {
+				return nil, err
+			}
+			defer func() {
+				_ = d.SetReadDeadline(time.Time{})
+			}()
+		}
+	}
+
+	pr := NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return m, err
+		}
+		msg := newMessage()
+		if err := pr.ReadMsgWithContext(ctx, msg); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return m, err
+		}
 		m = append(m, msg)
 	}
 	return m, nil
 }
 
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type resetter interface {
+	Reset() error
+}
+
 type Reader struct {
 	ggio.Reader
+	deadliner        readDeadliner
+	resetter         resetter
+	typeName         string
+	contextDeadlines bool
 }
 
-func newReader(r ggio.Reader) Reader {
-	return Reader{Reader: r}
+// newReader constructs a Reader that reads messages with r from src. If src
+// has a SetReadDeadline method, it is used to enforce read timeouts. If src
+// has a Reset method, it is used to reset src when Exchange fails.
+func newReader(r ggio.Reader, src io.Reader) Reader {
+	d, _ := src.(readDeadliner)
+	rs, _ := src.(resetter)
+	return Reader{Reader: r, deadliner: d, resetter: rs}
+}
+
+// ReadMsg reads the next message into msg. If the reader was created with
+// NewReaderNamed, errors other than io.EOF include the expected message type.
+func (r Reader) ReadMsg(msg proto.Message) error {
+	err := r.Reader.ReadMsg(msg)
+	if err != nil && err != io.EOF && r.typeName != "" {
+		return fmt.Errorf("read %s message: %w", r.typeName, err)
+	}
+	return err
 }
 
 func (r Reader) ReadMsgWithContext(ctx context.Context, msg proto.Message) error {
+	if r.contextDeadlines {
+		// contexts without a deadline clear the deadline of the previous read
+		deadline, _ := ctx.Deadline()
+		if err := r.deadliner.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
 	errChan := make(chan error, 1)
 	go func() {
 		errChan <- r.ReadMsg(msg)
@@ -69,6 +392,193 @@ func (r Reader) ReadMsgWithContext(ctx context.Context, msg proto.Message) error
 	}
 }
 
+// ReadMsgWithTimeout is like ReadMsgWithContext, but returns ErrTimeout if
+// the message is not read within the duration d. If the underlying reader
+// supports read deadlines, the deadline is also set on it for the duration of
+// the read, so that the read is interrupted even if it does not return on its
+// own.
+func (r Reader) ReadMsgWithTimeout(d time.Duration, msg proto.Message) error {
+	if r.deadliner != nil {
+		if err := r.deadliner.SetReadDeadline(time.Now().Add(d)); err != nil {
+			return err
+		}
+		defer func() {
+			_ = r.deadliner.SetReadDeadline(time.Time{})
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	if err := r.ReadMsgWithContext(ctx, msg); err != nil {
+		var timeoutErr interface{ Timeout() bool }
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &timeoutErr) && timeoutErr.Timeout()) {
+			return ErrTimeout
+		}
+		return err
+	}
+	return nil
+}
+
+// ExchangeError is returned by Exchange when it fails. It tells whether the
+// outgoing message was written before the failure.
+type ExchangeError struct {
+	Written bool  // the outgoing message was written
+	Err     error // the error of the failed write or read
+}
+
+func (e *ExchangeError) Error() string {
+	if e.Written {
+		return fmt.Sprintf("read message: %v", e.Err)
+	}
+	return fmt.Sprintf("write message: %v", e.Err)
+}
+
+func (e *ExchangeError) Unwrap() error {
+	return e.Err
+}
+
+// Exchange writes the message out to w and then reads the message in from r,
+// returning when ctx is done. Failures are returned as *ExchangeError. If
+// either fails and r is a Reader created from a stream with a Reset method,
+// such as p2p.Stream, the stream is reset, so that the peer does not wait for
+// a message that is not going to be read or written.
+func Exchange(ctx context.Context, w ggio.Writer, r ggio.Reader, out, in Message) (err error) {
+	pr, ok := r.(Reader)
+	if !ok {
+		pr = Reader{Reader: r}
+	}
+	defer func() {
+		if err != nil && pr.resetter != nil {
+			_ = pr.resetter.Reset()
+		}
+	}()
+
+	pw, ok := w.(Writer)
+	if !ok {
+		pw = newWriter(w)
+	}
+	if err := pw.WriteMsgWithContext(ctx, out); err != nil {
+		return &ExchangeError{Err: err}
+	}
+	if err := pr.ReadMsgWithContext(ctx, in); err != nil {
+		return &ExchangeError{Written: true, Err: err}
+	}
+	return nil
+}
+
+var readBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 4*1024)
+		return &b
+	},
+}
+
+// pooledReader reads length delimited messages, the same way as the reader
+// returned by ggio.NewDelimitedReader, using buffers from readBufferPool.
+type pooledReader struct {
+	r       *bufio.Reader
+	maxSize int
+}
+
+func (r *pooledReader) ReadMsg(msg proto.Message) error {
+	length64, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return err
+	}
+	length := int(length64)
+	if length < 0 || length > r.maxSize {
+		return io.ErrShortBuffer
+	}
+
+	bp := readBufferPool.Get().(*[]byte)
+	defer readBufferPool.Put(bp)
+
+	if cap(*bp) < length {
+		*bp = make([]byte, length)
+	}
+	buf := (*bp)[:length]
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return err
+	}
+	// Unmarshal copies the data into msg, so that the buffer can be safely
+	// returned to the pool and reused after the message is decoded.
+	return proto.Unmarshal(buf, msg)
+}
+
+// NewLimitedReader returns a reader that reads from r up to maxTotalBytes
+// bytes in total. Once more data is read from r, it returns
+// ErrStreamTooLarge. It bounds the data consumed from a single stream
+// regardless of the size of the individual messages read from it.
+func NewLimitedReader(r io.Reader, maxTotalBytes int64) io.Reader {
+	return &limitedReader{r: r, max: maxTotalBytes}
+}
+
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (r *limitedReader) Read(p []byte) (n int, err error) {
+	if r.read > r.max {
+		return 0, r.err()
+	}
+	// read at most one byte over the limit to detect that it is exceeded
+	if remaining := r.max - r.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err = r.r.Read(p)
+	r.read += int64(n)
+	if r.read > r.max {
+		return n - int(r.read-r.max), r.err()
+	}
+	return n, err
+}
+
+func (r *limitedReader) err() error {
+	return fmt.Errorf("read %d bytes with limit of %d bytes: %w", r.read, r.max, ErrStreamTooLarge)
+}
+
+// Counters holds the number of bytes that flowed through a stream created
+// with NewCountingWriterAndReader. It is safe for concurrent use.
+type Counters struct {
+	bytesIn  uint64
+	bytesOut uint64
+}
+
+// BytesIn returns the number of bytes read from the stream.
+func (c *Counters) BytesIn() uint64 {
+	return atomic.LoadUint64(&c.bytesIn)
+}
+
+// BytesOut returns the number of bytes written to the stream.
+func (c *Counters) BytesOut() uint64 {
+	return atomic.LoadUint64(&c.bytesOut)
+}
+
+type countingReader struct {
+	r io.Reader
+	c *Counters
+}
+
+func (r countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	atomic.AddUint64(&r.c.bytesIn, uint64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	c *Counters
+}
+
+func (w countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	atomic.AddUint64(&w.c.bytesOut, uint64(n))
+	return n, err
+}
+
 type Writer struct {
 	ggio.Writer
 }
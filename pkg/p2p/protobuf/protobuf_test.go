@@ -5,9 +5,16 @@
 package protobuf_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -65,6 +72,31 @@ func TestReader_ReadMsg(t *testing.T) {
 	}
 }
 
+func TestPooledReader(t *testing.T) {
+	messages := []string{"first", strings.Repeat("second", 1000), "third"}
+
+	r := protobuf.NewPooledReader(newMessageReader(messages, 0))
+
+	got := make([]*pb.Message, 0, len(messages))
+	for range messages {
+		msg := new(pb.Message)
+		if err := r.ReadMsg(msg); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, msg)
+	}
+	if err := r.ReadMsg(new(pb.Message)); err != io.EOF {
+		t.Fatalf("got error %v, want %v", err, io.EOF)
+	}
+
+	// messages must not be changed by reads that reuse pooled buffers
+	for i, msg := range got {
+		if msg.Text != messages[i] {
+			t.Errorf("got message %q, want %q", msg.Text, messages[i])
+		}
+	}
+}
+
 func TestReader_timeout(t *testing.T) {
 	messages := []string{"first", "second", "third"}
 
@@ -125,6 +157,105 @@ func TestReader_timeout(t *testing.T) {
 	}
 }
 
+func TestReader_ReadMsgWithTimeout(t *testing.T) {
+	messages := []string{"first", "second"}
+
+	r := protobuf.NewReader(newMessageReader(messages, 200*time.Millisecond))
+
+	var msg pb.Message
+	if err := r.ReadMsgWithTimeout(time.Second, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != messages[0] {
+		t.Errorf("got message %q, want %q", msg.Text, messages[0])
+	}
+
+	if err := r.ReadMsgWithTimeout(10*time.Millisecond, &msg); err != protobuf.ErrTimeout {
+		t.Fatalf("got error %v, want %v", err, protobuf.ErrTimeout)
+	}
+}
+
+func TestReader_ReadMsgWithTimeout_deadline(t *testing.T) {
+	r := &deadlineReader{Reader: newMessageReader([]string{"first"}, 0)}
+
+	var msg pb.Message
+	if err := protobuf.NewReader(r).ReadMsgWithTimeout(time.Second, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.deadlines) != 2 {
+		t.Fatalf("got %v deadlines set, want 2", len(r.deadlines))
+	}
+	if r.deadlines[0].IsZero() {
+		t.Error("read deadline not set")
+	}
+	if !r.deadlines[1].IsZero() {
+		t.Error("read deadline not cleared")
+	}
+}
+
+func TestNewDeadlineReader(t *testing.T) {
+	s := newBlockingStream()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var msg pb.Message
+	if err := protobuf.NewDeadlineReader(s).ReadMsgWithContext(ctx, &msg); !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the blocked read returns once the deadline of the context passed
+	select {
+	case <-s.returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("read not interrupted by the deadline")
+	}
+}
+
+func TestCountingWriterAndReader(t *testing.T) {
+	messages := []string{"first", "second", "third"}
+
+	var in bytes.Buffer
+	if err := protobuf.WriteMessages(&in, []protobuf.Message{
+		&pb.Message{Text: messages[0]},
+		&pb.Message{Text: messages[1]},
+		&pb.Message{Text: messages[2]},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	wantIn := uint64(in.Len())
+
+	var out bytes.Buffer
+	w, r, counters := protobuf.NewCountingWriterAndReader(readWriteStream{
+		noopWriteCloser: newNoopWriteCloser(&in),
+		w:               &out,
+	})
+
+	var msg pb.Message
+	for _, m := range messages {
+		if err := r.ReadMsg(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Text != m {
+			t.Errorf("got message %q, want %q", msg.Text, m)
+		}
+		if err := w.WriteMsg(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := counters.BytesIn(); got != wantIn {
+		t.Errorf("got %v bytes in, want %v", got, wantIn)
+	}
+	if got, want := counters.BytesOut(), uint64(out.Len()); got != want {
+		t.Errorf("got %v bytes out, want %v", got, want)
+	}
+	if counters.BytesOut() != wantIn {
+		t.Errorf("got %v bytes out, want %v", counters.BytesOut(), wantIn)
+	}
+}
+
 func TestWriter(t *testing.T) {
 	messages := []string{"first", "second", "third"}
 
@@ -224,6 +355,369 @@ func TestWriter_timeout(t *testing.T) {
 	}
 }
 
+func TestReader_maxSize(t *testing.T) {
+	messages := []string{"first"}
+
+	var msg pb.Message
+	r := protobuf.NewReaderWithMaxSize(newMessageReader(messages, 0), 3)
+	if err := r.ReadMsg(&msg); err != io.ErrShortBuffer {
+		t.Fatalf("got error %v, want %v", err, io.ErrShortBuffer)
+	}
+
+	r = protobuf.NewReaderWithMaxSize(newMessageReader(messages, 0), 16)
+	if err := r.ReadMsg(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != messages[0] {
+		t.Errorf("got message %q, want %q", msg.Text, messages[0])
+	}
+}
+
+func TestReaderNamed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := protobuf.WriteMessages(&buf, []protobuf.Message{&pb.Message{Text: "first"}}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	var msg pb.Message
+	r := protobuf.NewReaderNamed(bytes.NewReader(data[:len(data)-1]), "Message")
+	err := r.ReadMsg(&msg)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if !strings.Contains(err.Error(), "Message") {
+		t.Errorf("got error %q, want it to contain the message type", err)
+	}
+
+	r = protobuf.NewReaderNamed(bytes.NewReader(nil), "Message")
+	if err := r.ReadMsg(&msg); err != io.EOF {
+		t.Fatalf("got error %v, want %v", err, io.EOF)
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := protobuf.WriteMessages(&buf, []protobuf.Message{&pb.Message{Text: "first"}}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	t.Run("valid", func(t *testing.T) {
+		var msg pb.Message
+		if err := protobuf.DecodeMessage(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Text != "first" {
+			t.Errorf("got message %q, want %q", msg.Text, "first")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var msg pb.Message
+		if err := protobuf.DecodeMessage(data[:len(data)-1], &msg); err != io.ErrUnexpectedEOF {
+			t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var msg pb.Message
+		if err := protobuf.DecodeMessage(nil, &msg); err != io.EOF {
+			t.Fatalf("got error %v, want %v", err, io.EOF)
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		oversized := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(oversized, protobuf.DefaultMaxMessageSize+1)
+
+		var msg pb.Message
+		if err := protobuf.DecodeMessage(oversized[:n], &msg); err != io.ErrShortBuffer {
+			t.Fatalf("got error %v, want %v", err, io.ErrShortBuffer)
+		}
+	})
+}
+
+func TestRawFrame(t *testing.T) {
+	var buf bytes.Buffer
+	if err := protobuf.WriteMessages(&buf, []protobuf.Message{
+		&pb.Message{Text: "first"},
+		&pb.Message{Text: "second"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	t.Run("relay", func(t *testing.T) {
+		// the multi reader is not an io.ByteReader, so frames must be read
+		// without consuming the data after them
+		r := io.MultiReader(bytes.NewReader(data))
+
+		var relayed bytes.Buffer
+		for i := 0; i < 2; i++ {
+			frame, err := protobuf.ReadRawFrame(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := protobuf.WriteRawFrame(&relayed, frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := protobuf.ReadRawFrame(r); err != io.EOF {
+			t.Fatalf("got error %v, want %v", err, io.EOF)
+		}
+
+		if !bytes.Equal(relayed.Bytes(), data) {
+			t.Fatalf("got relayed data %x, want %x", relayed.Bytes(), data)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		r := bytes.NewReader(data[:3])
+		if _, err := protobuf.ReadRawFrame(r); err != io.ErrUnexpectedEOF {
+			t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		oversized := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(oversized, protobuf.DefaultMaxMessageSize+1)
+
+		if _, err := protobuf.ReadRawFrame(bytes.NewReader(oversized[:n])); err != io.ErrShortBuffer {
+			t.Fatalf("got error %v, want %v", err, io.ErrShortBuffer)
+		}
+	})
+}
+
+func TestReadGroup(t *testing.T) {
+	var buf bytes.Buffer
+	w := protobuf.NewWriter(&buf)
+	for _, group := range [][]string{{"first", "second"}, {"third"}} {
+		for _, text := range group {
+			if err := w.WriteMsg(&pb.Message{Text: text}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := protobuf.WriteGroupEnd(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// data after the groups that is not read as a message
+	buf.WriteString("trailer")
+
+	r := io.MultiReader(&buf)
+	newMessage := func() protobuf.Message { return new(pb.Message) }
+	for _, want := range [][]string{{"first", "second"}, {"third"}} {
+		msgs, err := protobuf.ReadGroup(r, newMessage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range msgs {
+			got = append(got, m.(*pb.Message).Text)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("got group %v, want %v", got, want)
+		}
+	}
+
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "trailer" {
+		t.Fatalf("got remaining data %q, want %q", rest, "trailer")
+	}
+
+	t.Run("unterminated", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := protobuf.WriteMessages(&buf, []protobuf.Message{&pb.Message{Text: "first"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := protobuf.ReadGroup(&buf, newMessage); err != io.ErrUnexpectedEOF {
+			t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+}
+
+func TestSetDefaultMaxMessageSize(t *testing.T) {
+	defer protobuf.ResetDefaultMaxMessageSize()
+
+	var buf bytes.Buffer
+	if err := protobuf.WriteMessages(&buf, []protobuf.Message{&pb.Message{Text: strings.Repeat("x", 100)}}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// readers created before the size is set keep the default size
+	before := protobuf.NewReader(bytes.NewReader(data))
+
+	if err := protobuf.SetDefaultMaxMessageSize(0); err == nil {
+		t.Fatal("expected error for invalid size")
+	}
+	if err := protobuf.SetDefaultMaxMessageSize(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := protobuf.SetDefaultMaxMessageSize(20); !errors.Is(err, protobuf.ErrMaxMessageSizeSet) {
+		t.Fatalf("got error %v, want %v", err, protobuf.ErrMaxMessageSizeSet)
+	}
+
+	var msg pb.Message
+	if err := before.ReadMsg(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := protobuf.NewReader(bytes.NewReader(data)).ReadMsg(&msg); err != io.ErrShortBuffer {
+		t.Fatalf("got error %v, want %v", err, io.ErrShortBuffer)
+	}
+	if err := protobuf.DecodeMessage(data, &msg); err != io.ErrShortBuffer {
+		t.Fatalf("got error %v, want %v", err, io.ErrShortBuffer)
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	messages := []string{"first", "second", "third"}
+
+	var buf bytes.Buffer
+	for _, m := range messages {
+		if err := protobuf.WriteMessages(&buf, []protobuf.Message{&pb.Message{Text: m}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := int64(buf.Len())
+
+	newMessage := func() protobuf.Message { return new(pb.Message) }
+
+	got, err := protobuf.ReadMessages(protobuf.NewLimitedReader(bytes.NewReader(buf.Bytes()), size), newMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(messages) {
+		t.Fatalf("got %d messages, want %d", len(got), len(messages))
+	}
+
+	_, err = protobuf.ReadMessages(protobuf.NewLimitedReader(bytes.NewReader(buf.Bytes()), size-1), newMessage)
+	if !errors.Is(err, protobuf.ErrStreamTooLarge) {
+		t.Fatalf("got error %v, want %v", err, protobuf.ErrStreamTooLarge)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var response bytes.Buffer
+		if err := protobuf.WriteMessages(&response, []protobuf.Message{&pb.Message{Text: "pong"}}); err != nil {
+			t.Fatal(err)
+		}
+		s := &resettableStream{Reader: &response}
+		w, r := protobuf.NewWriterAndReader(s)
+
+		var in pb.Message
+		if err := protobuf.Exchange(context.Background(), w, r, &pb.Message{Text: "ping"}, &in); err != nil {
+			t.Fatal(err)
+		}
+		if in.Text != "pong" {
+			t.Errorf("got message %q, want %q", in.Text, "pong")
+		}
+		var out pb.Message
+		if err := protobuf.DecodeMessage(s.written.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Text != "ping" {
+			t.Errorf("got written message %q, want %q", out.Text, "ping")
+		}
+		if s.reset {
+			t.Error("stream reset")
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		s := &resettableStream{Reader: bytes.NewReader(nil)}
+		w, r := protobuf.NewWriterAndReader(s)
+
+		err := protobuf.Exchange(context.Background(), w, r, &pb.Message{Text: "ping"}, new(pb.Message))
+		if !errors.Is(err, io.EOF) {
+			t.Fatalf("got error %v, want %v", err, io.EOF)
+		}
+		var exchangeErr *protobuf.ExchangeError
+		if !errors.As(err, &exchangeErr) || !exchangeErr.Written {
+			t.Fatalf("got error %v, want a read error after the message was written", err)
+		}
+		if !s.reset {
+			t.Error("stream not reset")
+		}
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		writeErr := errors.New("write failed")
+		s := &resettableStream{Reader: bytes.NewReader(nil), writeErr: writeErr}
+		w, r := protobuf.NewWriterAndReader(s)
+
+		err := protobuf.Exchange(context.Background(), w, r, &pb.Message{Text: "ping"}, new(pb.Message))
+		if !errors.Is(err, writeErr) {
+			t.Fatalf("got error %v, want %v", err, writeErr)
+		}
+		var exchangeErr *protobuf.ExchangeError
+		if !errors.As(err, &exchangeErr) || exchangeErr.Written {
+			t.Fatalf("got error %v, want a write error", err)
+		}
+		if !s.reset {
+			t.Error("stream not reset")
+		}
+	})
+}
+
+func TestBufferedWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		bufSize  int
+		messages []string
+	}{
+		{
+			name:     "fits buffer",
+			bufSize:  1024,
+			messages: []string{"first", "second", "third"},
+		},
+		{
+			name:     "exceeds buffer",
+			bufSize:  16,
+			messages: []string{"first", strings.Repeat("second", 10), "third"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, flush := protobuf.NewBufferedWriter(&buf, tc.bufSize)
+
+			var size int
+			for _, m := range tc.messages {
+				msg := &pb.Message{Text: m}
+				if err := w.WriteMsg(msg); err != nil {
+					t.Fatal(err)
+				}
+				size += msg.Size() + 1
+			}
+			if size <= tc.bufSize && buf.Len() != 0 {
+				t.Fatalf("got %d bytes written before flush", buf.Len())
+			}
+
+			if err := flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			msgs, err := protobuf.ReadMessages(&buf, func() protobuf.Message { return new(pb.Message) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != len(tc.messages) {
+				t.Fatalf("got %d messages, want %d", len(msgs), len(tc.messages))
+			}
+			for i, m := range msgs {
+				if got := m.(*pb.Message).Text; got != tc.messages[i] {
+					t.Errorf("got message %q, want %q", got, tc.messages[i])
+				}
+			}
+		})
+	}
+}
+
 func TestReadMessages(t *testing.T) {
 	messages := []string{"first", "second", "third"}
 
@@ -244,6 +738,248 @@ func TestReadMessages(t *testing.T) {
 	}
 }
 
+func TestReadMsgTyped(t *testing.T) {
+	var buf bytes.Buffer
+	if err := protobuf.WriteMessages(&buf, []protobuf.Message{&pb.Message{Text: "first"}, &pb.Message{Text: "second"}}); err != nil {
+		t.Fatal(err)
+	}
+	r := protobuf.NewReader(&buf)
+
+	var msg pb.Message
+	if err := protobuf.ReadMsgTyped(r, &msg, "test.Message"); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "first" {
+		t.Errorf("got message %q, want %q", msg.Text, "first")
+	}
+
+	if err := protobuf.ReadMsgTyped(r, &msg, "test.Delivery"); !errors.Is(err, protobuf.ErrUnexpectedMessageType) {
+		t.Fatalf("got error %v, want %v", err, protobuf.ErrUnexpectedMessageType)
+	}
+}
+
+func TestReadMessagesPartial(t *testing.T) {
+	messages := []string{"first", "second"}
+
+	var buf bytes.Buffer
+	w := protobuf.NewWriter(&buf)
+	for _, m := range messages {
+		if err := w.WriteMsg(&pb.Message{Text: m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// length prefix of a message that is never written
+	buf.WriteByte(10)
+
+	got, err := protobuf.ReadMessages(&buf, func() protobuf.Message { return new(pb.Message) })
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	var gotMessages []string
+	for _, m := range got {
+		gotMessages = append(gotMessages, m.(*pb.Message).Text)
+	}
+
+	if fmt.Sprint(gotMessages) != fmt.Sprint(messages) {
+		t.Errorf("got messages %v, want %v", gotMessages, messages)
+	}
+}
+
+func TestReadMessagesWithContext(t *testing.T) {
+	messages := []string{"first", "second", "third"}
+
+	t.Run("all messages", func(t *testing.T) {
+		r := newMessageReader(messages, 0)
+
+		got, err := protobuf.ReadMessagesWithContext(context.Background(), r, func() protobuf.Message { return new(pb.Message) })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var gotMessages []string
+		for _, m := range got {
+			gotMessages = append(gotMessages, m.(*pb.Message).Text)
+		}
+
+		if fmt.Sprint(gotMessages) != fmt.Sprint(messages) {
+			t.Errorf("got messages %v, want %v", gotMessages, messages)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r := newMessageReader(messages, 500*time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := protobuf.ReadMessagesWithContext(ctx, r, func() protobuf.Message { return new(pb.Message) })
+		if err != context.DeadlineExceeded {
+			t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("deadline cleared", func(t *testing.T) {
+		r := &deadlineReader{Reader: newMessageReader(messages, 0)}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if _, err := protobuf.ReadMessagesWithContext(ctx, r, func() protobuf.Message { return new(pb.Message) }); err != nil {
+			t.Fatal(err)
+		}
+
+		deadline, _ := ctx.Deadline()
+		if len(r.deadlines) != 2 || !r.deadlines[0].Equal(deadline) || !r.deadlines[1].IsZero() {
+			t.Fatalf("got deadlines %v, want %v and the zero time", r.deadlines, deadline)
+		}
+	})
+
+	t.Run("messages read before error", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := protobuf.WriteMessages(&buf, []protobuf.Message{&pb.Message{Text: messages[0]}}); err != nil {
+			t.Fatal(err)
+		}
+		errRead := errors.New("read failed")
+		r := io.MultiReader(&buf, errReader{err: errRead})
+
+		got, err := protobuf.ReadMessagesWithContext(context.Background(), r, func() protobuf.Message { return new(pb.Message) })
+		if !errors.Is(err, errRead) {
+			t.Fatalf("got error %v, want %v", err, errRead)
+		}
+		if len(got) != 1 || got[0].(*pb.Message).Text != messages[0] {
+			t.Fatalf("got messages %v, want %v", got, messages[:1])
+		}
+	})
+}
+
+// errReader is a reader that always fails with err.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestWriteMessages(t *testing.T) {
+	messages := []string{"first", "second", "third"}
+
+	var msgs []protobuf.Message
+	for _, m := range messages {
+		msgs = append(msgs, &pb.Message{Text: m})
+	}
+
+	var buf bytes.Buffer
+	if err := protobuf.WriteMessages(&buf, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := protobuf.ReadMessages(&buf, func() protobuf.Message { return new(pb.Message) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotMessages []string
+	for _, m := range got {
+		gotMessages = append(gotMessages, m.(*pb.Message).Text)
+	}
+
+	if fmt.Sprint(gotMessages) != fmt.Sprint(messages) {
+		t.Errorf("got messages %v, want %v", gotMessages, messages)
+	}
+}
+
+func TestRangeMessages(t *testing.T) {
+	messages := []string{"first", "second", "third"}
+	newMessage := func() protobuf.Message { return new(pb.Message) }
+
+	t.Run("all messages", func(t *testing.T) {
+		var gotMessages []string
+		err := protobuf.RangeMessages(newMessageReader(messages, 0), newMessage, func(m protobuf.Message) error {
+			gotMessages = append(gotMessages, m.(*pb.Message).Text)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprint(gotMessages) != fmt.Sprint(messages) {
+			t.Errorf("got messages %v, want %v", gotMessages, messages)
+		}
+	})
+
+	for _, tc := range []struct {
+		name    string
+		stopErr error
+		wantErr error
+	}{
+		{
+			name:    "stop with EOF",
+			stopErr: io.EOF,
+		},
+		{
+			name:    "stop with error",
+			stopErr: io.ErrUnexpectedEOF,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			for _, m := range messages {
+				if err := protobuf.NewWriter(&buf).WriteMsg(&pb.Message{Text: m}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var gotMessages []string
+			err := protobuf.RangeMessages(&buf, newMessage, func(m protobuf.Message) error {
+				gotMessages = append(gotMessages, m.(*pb.Message).Text)
+				return tc.stopErr
+			})
+			if err != tc.wantErr {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+
+			if fmt.Sprint(gotMessages) != fmt.Sprint(messages[:1]) {
+				t.Errorf("got messages %v, want %v", gotMessages, messages[:1])
+			}
+		})
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	var buf bytes.Buffer
+	if err := protobuf.NewWriter(&buf).WriteMsg(&pb.Message{Text: strings.Repeat("text", 1000)}); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	for _, bc := range []struct {
+		name       string
+		readerFunc func(r io.Reader) protobuf.Reader
+	}{
+		{
+			name:       "NewReader",
+			readerFunc: protobuf.NewReader,
+		},
+		{
+			name:       "NewPooledReader",
+			readerFunc: protobuf.NewPooledReader,
+		},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var msg pb.Message
+			for i := 0; i < b.N; i++ {
+				if err := bc.readerFunc(bytes.NewReader(data)).ReadMsg(&msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func newMessageReader(messages []string, delay time.Duration) io.Reader {
 	r, pipe := io.Pipe()
 	w := protobuf.NewWriter(pipe)
@@ -307,6 +1043,58 @@ func (d delayedReader) Read(p []byte) (n int, err error) {
 	return d.r.Read(p)
 }
 
+type deadlineReader struct {
+	io.Reader
+	deadlines []time.Time
+}
+
+func (d *deadlineReader) SetReadDeadline(t time.Time) error {
+	d.deadlines = append(d.deadlines, t)
+	return nil
+}
+
+// blockingStream is a stream whose reads block until its read deadline
+// passes.
+type blockingStream struct {
+	noopWriteCloser
+	mu       sync.Mutex
+	deadline time.Time
+	returned chan struct{}
+}
+
+func newBlockingStream() *blockingStream {
+	return &blockingStream{returned: make(chan struct{})}
+}
+
+func (s *blockingStream) Read(p []byte) (n int, err error) {
+	defer close(s.returned)
+	for {
+		s.mu.Lock()
+		deadline := s.deadline
+		s.mu.Unlock()
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *blockingStream) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = t
+	return nil
+}
+
+type readWriteStream struct {
+	noopWriteCloser
+	w io.Writer
+}
+
+func (s readWriteStream) Write(p []byte) (n int, err error) {
+	return s.w.Write(p)
+}
+
 type noopWriteCloser struct {
 	io.Reader
 }
@@ -370,3 +1158,38 @@ func (noopReadCloser) FullClose() error {
 func (noopReadCloser) Reset() error {
 	return nil
 }
+
+type resettableStream struct {
+	io.Reader
+	written  bytes.Buffer
+	writeErr error
+	reset    bool
+}
+
+func (s *resettableStream) Write(p []byte) (n int, err error) {
+	if s.writeErr != nil {
+		return 0, s.writeErr
+	}
+	return s.written.Write(p)
+}
+
+func (s *resettableStream) Close() error {
+	return nil
+}
+
+func (s *resettableStream) FullClose() error {
+	return nil
+}
+
+func (s *resettableStream) Headers() p2p.Headers {
+	return nil
+}
+
+func (s *resettableStream) ResponseHeaders() p2p.Headers {
+	return nil
+}
+
+func (s *resettableStream) Reset() error {
+	s.reset = true
+	return nil
+}
@@ -123,7 +123,7 @@ func (r *Recorder) NewStream(ctx context.Context, addr swarm.Address, h p2p.Head
 		}
 	}
 	if handler == nil {
-		return nil, ErrStreamNotSupported
+		return nil, p2p.NewIncompatibleStreamError(ErrStreamNotSupported)
 	}
 	for i := len(r.middlewares) - 1; i >= 0; i-- {
 		handler = r.middlewares[i](handler)
@@ -131,6 +131,9 @@ func (r *Recorder) NewStream(ctx context.Context, addr swarm.Address, h p2p.Head
 	if headler != nil {
 		streamOut.headers = headler(h, addr)
 	}
+	// the handler sees the headers sent by the stream opener
+	streamIn.headers = h
+	streamIn.responseHeaders = streamOut.headers
 	record := &Record{in: recordIn, out: recordOut, done: make(chan struct{})}
 	go func() {
 		defer close(record.done)
@@ -46,12 +46,18 @@ type PaymentThresholdObserver interface {
 	NotifyPaymentThreshold(peer swarm.Address, paymentThreshold *big.Int) error
 }
 
+// PeerPriceObserver is used for being notified when a peer announces its pricing terms
+type PeerPriceObserver interface {
+	NotifyPeerPrice(peer swarm.Address)
+}
+
 type Service struct {
 	streamer                 p2p.Streamer
 	logger                   logging.Logger
 	paymentThreshold         *big.Int
 	minPaymentThreshold      *big.Int
 	paymentThresholdObserver PaymentThresholdObserver
+	peerPriceObserver        PeerPriceObserver
 }
 
 func New(streamer p2p.Streamer, logger logging.Logger, paymentThreshold *big.Int, minThreshold *big.Int) *Service {
@@ -102,6 +108,10 @@ func (s *Service) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (e
 		return p2p.NewDisconnectError(ErrThresholdTooLow)
 	}
 
+	if s.peerPriceObserver != nil {
+		s.peerPriceObserver.NotifyPeerPrice(p.Address)
+	}
+
 	if paymentThreshold.Cmp(big.NewInt(0)) == 0 {
 		return err
 	}
@@ -146,3 +156,8 @@ func (s *Service) AnnouncePaymentThreshold(ctx context.Context, peer swarm.Addre
 func (s *Service) SetPaymentThresholdObserver(observer PaymentThresholdObserver) {
 	s.paymentThresholdObserver = observer
 }
+
+// SetPeerPriceObserver sets the PeerPriceObserver to be used when receiving a pricing announcement
+func (s *Service) SetPeerPriceObserver(observer PeerPriceObserver) {
+	s.peerPriceObserver = observer
+}
@@ -34,13 +34,23 @@ func (t *testThresholdObserver) NotifyPaymentThreshold(peerAddr swarm.Address, p
 	return nil
 }
 
+type testPeerPriceObserver struct {
+	peers []swarm.Address
+}
+
+func (t *testPeerPriceObserver) NotifyPeerPrice(peerAddr swarm.Address) {
+	t.peers = append(t.peers, peerAddr)
+}
+
 func TestAnnouncePaymentThreshold(t *testing.T) {
 	logger := logging.New(ioutil.Discard, 0)
 	testThreshold := big.NewInt(100000)
 	observer := &testThresholdObserver{}
+	priceObserver := &testPeerPriceObserver{}
 
 	recipient := pricing.New(nil, logger, testThreshold, big.NewInt(1000))
 	recipient.SetPaymentThresholdObserver(observer)
+	recipient.SetPeerPriceObserver(priceObserver)
 
 	peerID := swarm.MustParseHexAddress("9ee7add7")
 
@@ -97,6 +107,10 @@ func TestAnnouncePaymentThreshold(t *testing.T) {
 	if !observer.peer.Equal(peerID) {
 		t.Fatalf("observer called with wrong peer. got %v, want %v", observer.peer, peerID)
 	}
+
+	if len(priceObserver.peers) != 1 || !priceObserver.peers[0].Equal(peerID) {
+		t.Fatalf("peer price observer called with peers %v, want %v", priceObserver.peers, peerID)
+	}
 }
 
 func TestAnnouncePaymentWithInsufficientThreshold(t *testing.T) {
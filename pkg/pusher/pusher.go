@@ -176,7 +176,7 @@ LOOP:
 
 				if receipt != nil {
 					var publicKey *ecdsa.PublicKey
-					publicKey, err = crypto.Recover(receipt.Signature, receipt.Address.Bytes())
+					publicKey, err = crypto.Recover(receipt.Signature, pushsync.ReceiptPayload(receipt.Address))
 					if err != nil {
 						err = fmt.Errorf("pusher: receipt recover: %w", err)
 						return
@@ -0,0 +1,48 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+
+	"github.com/ethersphere/bee/pkg/accounting"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// WithAccountingDisabled skips reserving, releasing, crediting and debiting
+// the prices of receipts, for deployments where all peers are trusted. The
+// prices are still computed and exchanged with the peers, so that nodes with
+// disabled accounting remain compatible with the other nodes.
+func WithAccountingDisabled(disabled bool) Option {
+	return func(ps *PushSync) {
+		if !disabled {
+			return
+		}
+		if _, ok := ps.accounting.(disabledAccounting); ok {
+			return
+		}
+		ps.accounting = disabledAccounting{Interface: ps.accounting}
+	}
+}
+
+// disabledAccounting ignores the accounting actions of pushsync, while the
+// balances are still returned by the wrapped accounting.
+type disabledAccounting struct {
+	accounting.Interface
+}
+
+func (disabledAccounting) Reserve(context.Context, swarm.Address, uint64) error { return nil }
+func (disabledAccounting) Release(swarm.Address, uint64)                        {}
+func (disabledAccounting) Credit(swarm.Address, uint64) error                   { return nil }
+
+func (disabledAccounting) PrepareDebit(swarm.Address, uint64) accounting.Action {
+	return noopAction{}
+}
+
+// noopAction is an accounting action that does nothing.
+type noopAction struct{}
+
+func (noopAction) Cleanup()     {}
+func (noopAction) Apply() error { return nil }
@@ -0,0 +1,69 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"errors"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// ackHeader is the name of the stream header with which the sender of a
+// delivery asks for a pb.Ack to be written back as soon as the delivery is
+// read, before the chunk is stored or forwarded. Peers that support it
+// return the header in the response headers of the stream, so that peers
+// that do not know it are not waited on for an acknowledgment.
+const ackHeader = "ack"
+
+var (
+	// ErrNotDelivered is matched by errors of pushes to peers that did not
+	// acknowledge the delivery of the chunk.
+	ErrNotDelivered = errors.New("chunk not delivered")
+	// ErrDeliveredNoReceipt is matched by errors of pushes to peers that
+	// acknowledged the delivery of the chunk, but did not return a valid
+	// receipt for it.
+	ErrDeliveredNoReceipt = errors.New("chunk delivered without receipt")
+)
+
+// ackHeadler returns the ack header in the response headers of streams whose
+// sender asked for an acknowledgment.
+func ackHeadler(headers p2p.Headers, _ swarm.Address) p2p.Headers {
+	if _, ok := headers[ackHeader]; !ok {
+		return nil
+	}
+	return p2p.Headers{ackHeader: []byte{1}}
+}
+
+// wantsAck reports whether headers contain the ack header. On the side of
+// the sender of a delivery, the headers of the stream are the response
+// headers of the peer.
+func wantsAck(headers p2p.Headers) bool {
+	_, ok := headers[ackHeader]
+	return ok
+}
+
+// deliveryError is the error of a push with delivery acknowledgment. It
+// matches ErrDeliveredNoReceipt if the delivery was acknowledged and
+// ErrNotDelivered otherwise.
+type deliveryError struct {
+	err   error
+	acked bool
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *deliveryError) Unwrap() error {
+	return e.err
+}
+
+func (e *deliveryError) Is(target error) bool {
+	if e.acked {
+		return target == ErrDeliveredNoReceipt
+	}
+	return target == ErrNotDelivered
+}
@@ -0,0 +1,256 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+	"github.com/ethersphere/bee/pkg/p2p/protobuf"
+	"github.com/ethersphere/bee/pkg/pushsync/pb"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// errBatchStreamBusy is returned by pushes that timed out waiting for their
+// turn on the batch stream to a peer.
+var errBatchStreamBusy = errors.New("batch stream busy")
+
+// PushChunksToClosest pushes multiple chunks to their closest peers. Every
+// chunk is pushed concurrently like by PushChunkToClosest, but the chunks that
+// are delivered to the same peer share a single batch stream to it, on which
+// they are delivered one after the other. Chunks are delivered to peers that
+// do not accept batch streams on streams of their own. The returned receipts
+// and errors are indexed the same as chunks.
+func (ps *PushSync) PushChunksToClosest(ctx context.Context, chunks []swarm.Chunk) ([]*Receipt, []error) {
+	var (
+		receipts = make([]*Receipt, len(chunks))
+		errs     = make([]error, len(chunks))
+		streams  = newBatchStreams()
+	)
+	defer streams.close()
+	ctx = context.WithValue(ctx, batchStreamsKey{}, streams)
+
+	var wg sync.WaitGroup
+	for i, ch := range chunks {
+		wg.Add(1)
+		go func(i int, ch swarm.Chunk) {
+			defer wg.Done()
+			receipts[i], errs[i] = ps.PushChunkToClosest(ctx, ch)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	return receipts, errs
+}
+
+type batchStreamsKey struct{}
+
+// batchStreams are the batch streams to peers that the pushes made by a call
+// to PushChunksToClosest share.
+type batchStreams struct {
+	mtx   sync.Mutex
+	peers map[string]*batchStream
+}
+
+// batchStream is the batch stream to a single peer. Holding sem grants the
+// use of the stream for a single delivery.
+type batchStream struct {
+	sem         chan struct{}
+	stream      *pushStream // nil if the stream is not open
+	unsupported bool        // the peer does not accept batch streams
+}
+
+func newBatchStreams() *batchStreams {
+	return &batchStreams{peers: make(map[string]*batchStream)}
+}
+
+// acquire waits for the batch stream to the peer, opening it with open if it
+// is not open yet, and returns it together with the function that has to be
+// called with the error of the delivery on it, if any. The stream is reset
+// and reopened for the next delivery if the delivery failed. If ok is false,
+// the peer does not accept batch streams and the chunk has to be delivered on
+// a stream of its own.
+func (b *batchStreams) acquire(ctx context.Context, peer swarm.Address, open func() (*pushStream, error)) (s *pushStream, done func(error), ok bool, err error) {
+	b.mtx.Lock()
+	bs, found := b.peers[peer.ByteString()]
+	if !found {
+		bs = &batchStream{sem: make(chan struct{}, 1)}
+		b.peers[peer.ByteString()] = bs
+	}
+	b.mtx.Unlock()
+
+	select {
+	case bs.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, false, fmt.Errorf("%w: %v", errBatchStreamBusy, ctx.Err())
+	}
+
+	if bs.unsupported {
+		<-bs.sem
+		return nil, nil, false, nil
+	}
+	if bs.stream == nil {
+		if bs.stream, err = open(); err != nil {
+			bs.unsupported = true
+			<-bs.sem
+			return nil, nil, false, nil
+		}
+	}
+
+	return bs.stream, func(err error) {
+		if err != nil {
+			_ = bs.stream.stream.Reset()
+			bs.stream = nil
+		}
+		<-bs.sem
+	}, true, nil
+}
+
+// close waits for the deliveries in progress and closes the batch streams.
+// The streams can not be acquired anymore afterwards.
+func (b *batchStreams) close() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, bs := range b.peers {
+		bs.sem <- struct{}{}
+		if bs.stream != nil {
+			_ = bs.stream.stream.Close()
+		}
+	}
+}
+
+// pushBatch delivers chunks to the peer over a single batch stream, one after
+// the other, the way they are replicated to neighbors, without the options of
+// the pushes to the closest peer. It returns the receipts of the chunks
+// delivered before the first error, in the order of the chunks.
+func (ps *PushSync) pushBatch(ctx context.Context, peer swarm.Address, chunks []swarm.Chunk) ([]*Receipt, error) {
+	ctx = withoutSentTag(ctx)
+
+	streamer, err := ps.streamer.NewStream(ctx, peer, makeHopsHeaders(ctx), protocolName, protocolVersion, batchStreamName)
+	if err != nil {
+		return nil, ps.newStreamError(peer, err)
+	}
+	defer streamer.Close()
+
+	w, r := protobuf.NewWriter(streamer), protobuf.NewReaderNamed(streamer, "Receipt")
+
+	receipts := make([]*Receipt, 0, len(chunks))
+	for _, ch := range chunks {
+		receipt, price, _, err := ps.pushBatchChunk(ctx, w, r, peer, ch)
+		if err != nil {
+			_ = streamer.Reset()
+			return receipts, err
+		}
+		receipts = append(receipts, newReceipt(receipt, peer, ch.Address(), price))
+	}
+
+	return receipts, nil
+}
+
+// pushBatchChunk delivers a single chunk of a batch, taking care of the
+// accounting for its receipt. It returns the receipt and the price paid for
+// it, and reports whether the delivery was attempted.
+func (ps *PushSync) pushBatchChunk(ctx context.Context, w protobuf.Writer, r protobuf.Reader, peer swarm.Address, ch swarm.Chunk) (*pb.ReceiptBundle, uint64, bool, error) {
+	ctx, cancel := ps.withTimeout(ctx, ps.timeToLive)
+	defer cancel()
+
+	receiptPrice := ps.peerPrice(peer, ch.Address())
+
+	if err := ps.reserve(ctx, peer, receiptPrice); err != nil {
+		return nil, 0, false, err
+	}
+	defer ps.accounting.Release(peer, receiptPrice)
+
+	stamp, err := ch.Stamp().MarshalBinary()
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	receipt, _, err := ps.deliver(ctx, w, r, false, false, false, peer, ch, stamp)
+	if err != nil {
+		return nil, 0, true, err
+	}
+
+	if err := ps.accounting.Credit(peer, receiptPrice); err != nil {
+		return nil, 0, true, err
+	}
+
+	return receipt, receiptPrice, true, nil
+}
+
+// batchHandlerFor returns the handler for batch streams of the protocol
+// version.
+func (ps *PushSync) batchHandlerFor(version string) p2p.HandlerFunc {
+	return func(ctx context.Context, p p2p.Peer, stream p2p.Stream) error {
+		return ps.batchHandler(ctx, p, stream, version)
+	}
+}
+
+// batchHandler handles multiple chunk deliveries from other node over a
+// single stream, writing back a receipt for each of them in order. The
+// headers of the stream apply to all of its deliveries.
+func (ps *PushSync) batchHandler(ctx context.Context, p p2p.Peer, stream p2p.Stream, version string) (err error) {
+	w, r := protobuf.NewWriter(stream), protobuf.NewReaderNamed(stream, "Delivery")
+	ctx, cancel := ps.withQuit(ctx)
+	defer cancel()
+	defer func() {
+		if err != nil {
+			ps.recorder.IncErrors()
+			_ = stream.Reset()
+		} else {
+			_ = stream.FullClose()
+		}
+	}()
+	if ps.isClosed() {
+		return ErrClosed
+	}
+	if ctx, err = ps.checkHops(ctx, stream); err != nil {
+		return err
+	}
+	ctx = withReplicaReceipts(ctx, stream.Headers())
+	ctx = withCustody(ctx, stream.Headers())
+	ctx = withInclusionProof(ctx, stream.Headers())
+	if ctx, err = withSenderDepth(ctx, stream.Headers()); err != nil {
+		return err
+	}
+	ack := wantsAck(stream.Headers())
+
+	for {
+		var done bool
+		if done, err = ps.handleBatchDelivery(ctx, p, w, r, ack, version); err != nil || done {
+			return err
+		}
+	}
+}
+
+// handleBatchDelivery reads and handles the next delivery of a batch stream.
+// It reports done when the sender has no more chunks to deliver.
+func (ps *PushSync) handleBatchDelivery(ctx context.Context, p p2p.Peer, w protobuf.Writer, r protobuf.Reader, ack bool, version string) (done bool, err error) {
+	ctx, cancel := ps.withTimeout(ctx, ps.timeToLive)
+	defer cancel()
+
+	var ch pb.Delivery
+	if err := r.ReadMsgWithContext(ctx, &ch); err != nil {
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		return false, fmt.Errorf("pushsync read delivery: %w", err)
+	}
+	ps.recorder.IncReceived()
+	ps.metrics.ChunkDataSize.Observe(float64(len(ch.Data)))
+
+	if ack {
+		if err := w.WriteMsgWithContext(ctx, &pb.Ack{Address: ch.Address}); err != nil {
+			return false, fmt.Errorf("pushsync write ack: %w", err)
+		}
+	}
+
+	return false, ps.handleDelivery(ctx, p, w, &ch, version)
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"errors"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// storageFullHeader is the name of the response header with which a peer
+// lets the sender of a delivery know that its storage is full, so that the
+// chunk is pushed to another peer instead.
+const storageFullHeader = "storage-full"
+
+// ErrStorageFull is matched by errors of deliveries that were rejected
+// because the storage of the receiving node is full.
+var ErrStorageFull = errors.New("storage full")
+
+// CapacityChecker reports whether the local storage can accept new chunks.
+type CapacityChecker interface {
+	// Full reports whether the storage is over its high-water mark and new
+	// deliveries should be rejected.
+	Full() bool
+}
+
+// WithCapacityChecker rejects deliveries while the capacity checker reports
+// that the storage is full.
+func WithCapacityChecker(c CapacityChecker) Option {
+	return func(ps *PushSync) {
+		ps.capacity = c
+	}
+}
+
+// storageFull reports whether deliveries are rejected because the storage is
+// full.
+func (ps *PushSync) storageFull() bool {
+	return ps.capacity != nil && ps.capacity.Full()
+}
+
+// headler returns the response headers of a delivery stream. In addition to
+// the ack header, it echoes the custody and inclusion proof headers if the
+// sender asked for them, and contains the storage full header if deliveries
+// are rejected.
+func (ps *PushSync) headler(headers p2p.Headers, addr swarm.Address) p2p.Headers {
+	h := ackHeadler(headers, addr)
+	set := func(name string) {
+		if h == nil {
+			h = make(p2p.Headers)
+		}
+		h[name] = []byte{1}
+	}
+	if hasCustodyHeader(headers) {
+		set(custodyHeader)
+	}
+	if hasInclusionProofHeader(headers) {
+		set(inclusionProofHeader)
+	}
+	if ps.storageFull() {
+		set(storageFullHeader)
+	}
+	return h
+}
+
+// peerStorageFull reports whether headers contain the storage full header.
+// On the side of the sender of a delivery, the headers of the stream are the
+// response headers of the peer.
+func peerStorageFull(headers p2p.Headers) bool {
+	_, ok := headers[storageFullHeader]
+	return ok
+}
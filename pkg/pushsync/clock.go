@@ -0,0 +1,63 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of time used by PushSync for timeouts, cooldowns, cache
+// expiry and the measured durations.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is a Clock that uses the system time.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// withTimeout returns a copy of ctx that is done once the duration d has
+// passed on the clock, in which case its error is context.DeadlineExceeded.
+func (ps *PushSync) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ps.clock.(realClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	tctx := &timeoutContext{Context: ctx, deadline: ps.clock.Now().Add(d)}
+	go func() {
+		select {
+		case <-ps.clock.After(d):
+			atomic.StoreInt32(&tctx.expired, 1)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return tctx, cancel
+}
+
+// timeoutContext is a context cancelled by a Clock that reports
+// context.DeadlineExceeded once it has expired.
+type timeoutContext struct {
+	context.Context
+	deadline time.Time
+	expired  int32
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *timeoutContext) Err() error {
+	if atomic.LoadInt32(&c.expired) == 1 {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
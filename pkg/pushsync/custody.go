@@ -0,0 +1,105 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethersphere/bee/pkg/crypto"
+	"github.com/ethersphere/bee/pkg/p2p"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// custodyHeader is the name of the stream header with which the sender of a
+// delivery asks for a receipt that signs the CustodyDigest of the chunk
+// instead of its address. Peers that support it return the header in the
+// response headers of the stream, while the receipts of peers that do not
+// know the header keep signing the address.
+const custodyHeader = "proof-of-custody"
+
+// errNoCustody is returned by forwarding nodes when the sender asked for
+// proof of custody, but the receipt of the storer does not provide it.
+var errNoCustody = errors.New("receipt without proof of custody")
+
+type custodyKey struct{}
+
+// WithProofOfCustody asks the peers for receipts that sign the CustodyDigest
+// of the pushed chunks, attesting that the storer held the chunk data.
+// Receipts of peers that do not support it sign the chunk address.
+func WithProofOfCustody(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.proofOfCustody = enabled
+	}
+}
+
+// ReceiptPayload returns the payload signed by receipts for the chunk with
+// the address, unless they are receipts with proof of custody, which sign the
+// CustodyDigest of the chunk instead.
+func ReceiptPayload(chunkAddr swarm.Address) []byte {
+	return chunkAddr.Bytes()
+}
+
+// CustodyDigest returns the digest signed by receipts with proof of custody,
+// the hash of the chunk address concatenated with the chunk data.
+func CustodyDigest(ch swarm.Chunk) ([]byte, error) {
+	return crypto.LegacyKeccak256(append(ch.Address().Bytes(), ch.Data()...))
+}
+
+// ReceiptNonceDigest returns the digest signed by receipts with a nonce, the
+// hash of the digest that the receipt would sign without a nonce concatenated
+// with the nonce.
+func ReceiptNonceDigest(digest, nonce []byte) ([]byte, error) {
+	return crypto.LegacyKeccak256(append(digest[:len(digest):len(digest)], nonce...))
+}
+
+// signedDigest returns the digest signed by a receipt with the nonce, which
+// is digest itself if the receipt has no nonce.
+func signedDigest(digest, nonce []byte) ([]byte, error) {
+	if len(nonce) == 0 {
+		return digest, nil
+	}
+	return ReceiptNonceDigest(digest, nonce)
+}
+
+// withCustody returns a copy of ctx that records whether the sender of the
+// delivery handled within it asked for proof of custody in headers.
+func withCustody(ctx context.Context, headers p2p.Headers) context.Context {
+	if !hasCustodyHeader(headers) {
+		return ctx
+	}
+	return context.WithValue(ctx, custodyKey{}, true)
+}
+
+// wantsCustody reports whether the sender of the delivery handled within ctx
+// asked for proof of custody.
+func wantsCustody(ctx context.Context) bool {
+	want, _ := ctx.Value(custodyKey{}).(bool)
+	return want
+}
+
+// requestCustody reports whether a push made within ctx asks the peer for
+// proof of custody, either because it is enabled on this node or because the
+// sender of the forwarded delivery asked for it.
+func (ps *PushSync) requestCustody(ctx context.Context) bool {
+	return ps.proofOfCustody || wantsCustody(ctx)
+}
+
+// hasCustodyHeader reports whether headers contain the custody header. On
+// the side of the sender of a delivery, the headers of the stream are the
+// response headers of the peer.
+func hasCustodyHeader(headers p2p.Headers) bool {
+	_, ok := headers[custodyHeader]
+	return ok
+}
+
+// receiptDigest returns the digest that the receipt for the chunk signs,
+// which is its CustodyDigest if custody is true and its address otherwise.
+func receiptDigest(ch swarm.Chunk, custody bool) ([]byte, error) {
+	if !custody {
+		return ReceiptPayload(ch.Address()), nil
+	}
+	return CustodyDigest(ch)
+}
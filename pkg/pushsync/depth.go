@@ -0,0 +1,64 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// senderDepthHeader is the name of the stream header with which full nodes
+// report their storage depth to the peers they push chunks to. Peers that do
+// not know the header ignore it.
+const senderDepthHeader = "sender-depth"
+
+type senderDepthKey struct{}
+
+// withSenderDepth returns a copy of ctx with the storage depth reported by
+// the sender of the delivery in headers, if any.
+func withSenderDepth(ctx context.Context, headers p2p.Headers) (context.Context, error) {
+	depth, ok := headers[senderDepthHeader]
+	if !ok {
+		return ctx, nil
+	}
+	if len(depth) != 1 {
+		return nil, fmt.Errorf("sender depth header length %d", len(depth))
+	}
+	return context.WithValue(ctx, senderDepthKey{}, depth[0]), nil
+}
+
+// senderDepth returns the storage depth reported by the sender of the
+// delivery handled within ctx, and whether it was reported.
+func senderDepth(ctx context.Context) (uint8, bool) {
+	depth, ok := ctx.Value(senderDepthKey{}).(uint8)
+	return depth, ok
+}
+
+// setSenderDepthHeader adds the storage depth of this node to the headers of
+// a push stream. Only full nodes store chunks, so light nodes do not report
+// it.
+func (ps *PushSync) setSenderDepthHeader(headers p2p.Headers) {
+	if !ps.isFullNode {
+		return
+	}
+	headers[senderDepthHeader] = []byte{ps.topologyDriver.NeighborhoodDepth()}
+}
+
+// checkSenderDepth warns if the sender of the delivery handled within ctx
+// forwarded a chunk that is within its reported storage depth, as it should
+// have stored the chunk itself.
+func (ps *PushSync) checkSenderDepth(ctx context.Context, p p2p.Peer, chunk swarm.Address) {
+	depth, ok := senderDepth(ctx)
+	if !ok || !p.FullNode {
+		return
+	}
+	if po := swarm.Proximity(p.Address.Bytes(), chunk.Bytes()); po >= depth {
+		ps.metrics.TotalUpstreamWithinDepth.Inc()
+		ps.logger.Warningf("pushsync: peer %s forwarded chunk %s within its storage depth %d (proximity %d)", p.Address, chunk, depth, po)
+	}
+}
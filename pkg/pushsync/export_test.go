@@ -4,9 +4,22 @@
 
 package pushsync
 
+import "github.com/ethersphere/bee/pkg/tags"
+
 var (
-	ProtocolName       = protocolName
-	ProtocolVersion    = protocolVersion
-	StreamName         = streamName
-	FailedRequestCache = newFailedRequestCache
+	ProtocolName         = protocolName
+	ProtocolVersion      = protocolVersion
+	StreamName           = streamName
+	BatchStreamName      = batchStreamName
+	FailedRequestCache   = newFailedRequestCache
+	PeerCircuitBreaker   = newPeerCircuitBreaker
+	PeerPriceCache       = newPeerPriceCache
+	RecentFailures       = newRecentFailures
+	CustodyHeader        = custodyHeader
+	SenderDepthHeader    = senderDepthHeader
+	InclusionProofHeader = inclusionProofHeader
 )
+
+func SetIncTag(f func(*tags.Tag, tags.State) error) {
+	incTag = f
+}
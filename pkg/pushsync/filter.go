@@ -0,0 +1,42 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// ErrChunkFiltered is matched by errors of deliveries that were rejected
+// because the address filter does not allow the chunk.
+var ErrChunkFiltered = errors.New("chunk filtered")
+
+// AddressFilter decides which chunks this node stores and forwards.
+type AddressFilter interface {
+	// Allowed reports whether the chunk with the address may be stored or
+	// forwarded.
+	Allowed(addr swarm.Address) bool
+}
+
+// WithAddressFilter rejects deliveries of chunks that the filter does not
+// allow, before they are stored or forwarded. Chunks that this node is the
+// closest to are also not stored on self if the filter does not allow them.
+func WithAddressFilter(f AddressFilter) Option {
+	return func(ps *PushSync) {
+		ps.addressFilter = f
+	}
+}
+
+// checkAddressFilter returns an error matching ErrChunkFiltered if the
+// address filter does not allow the chunk with the address.
+func (ps *PushSync) checkAddressFilter(addr swarm.Address) error {
+	if ps.addressFilter == nil || ps.addressFilter.Allowed(addr) {
+		return nil
+	}
+	ps.metrics.TotalChunksFiltered.Inc()
+	return fmt.Errorf("chunk %s: %w", addr, ErrChunkFiltered)
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+)
+
+// hopsHeader is the name of the stream header that carries the number of
+// times a chunk has been delivered on its way from the originator, including
+// the delivery over the stream.
+const hopsHeader = "hops"
+
+// ErrMaxHopsExceeded is returned by the handler for deliveries of chunks that
+// have been forwarded more times than allowed, which happens if peers forward
+// the chunk in a loop.
+var ErrMaxHopsExceeded = errors.New("max hops exceeded")
+
+type hopsKey struct{}
+
+// withHops returns a copy of ctx with the number of hops of the delivery that
+// is handled.
+func withHops(ctx context.Context, hops uint64) context.Context {
+	return context.WithValue(ctx, hopsKey{}, hops)
+}
+
+// hopsFromContext returns the number of hops of the delivery handled within
+// ctx, or 0 if the chunk is pushed by its originator.
+func hopsFromContext(ctx context.Context) uint64 {
+	hops, _ := ctx.Value(hopsKey{}).(uint64)
+	return hops
+}
+
+// makeHopsHeaders returns the headers of a stream that delivers a chunk one
+// hop further than the delivery handled within ctx.
+func makeHopsHeaders(ctx context.Context) p2p.Headers {
+	hops := make([]byte, 8)
+	binary.BigEndian.PutUint64(hops, hopsFromContext(ctx)+1)
+	return p2p.Headers{hopsHeader: hops}
+}
+
+// parseHopsHeader returns the number of hops from the stream headers, or 0
+// if the peer did not send them.
+func parseHopsHeader(headers p2p.Headers) (uint64, error) {
+	hops, ok := headers[hopsHeader]
+	if !ok {
+		return 0, nil
+	}
+	if len(hops) != 8 {
+		return 0, fmt.Errorf("hops header length %d", len(hops))
+	}
+	return binary.BigEndian.Uint64(hops), nil
+}
+
+// checkHops validates the number of hops of an incoming stream and returns a
+// copy of ctx that carries it for forwarding.
+func (ps *PushSync) checkHops(ctx context.Context, stream p2p.Stream) (context.Context, error) {
+	hops, err := parseHopsHeader(stream.Headers())
+	if err != nil {
+		return nil, err
+	}
+	if ps.maxHops > 0 && hops > ps.maxHops {
+		ps.metrics.TotalMaxHopsExceeded.Inc()
+		return nil, fmt.Errorf("delivery with %d hops: %w", hops, ErrMaxHopsExceeded)
+	}
+	return withHops(ctx, hops), nil
+}
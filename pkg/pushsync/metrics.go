@@ -5,19 +5,56 @@
 package pushsync
 
 import (
+	"time"
+
 	m "github.com/ethersphere/bee/pkg/metrics"
+	"github.com/ethersphere/bee/pkg/swarm"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type metrics struct {
-	TotalSent               prometheus.Counter
-	TotalReceived           prometheus.Counter
-	TotalErrors             prometheus.Counter
-	TotalReplicated         prometheus.Counter
-	TotalReplicatedError    prometheus.Counter
-	TotalSendAttempts       prometheus.Counter
-	TotalFailedSendAttempts prometheus.Counter
-	TotalFailedCacheHits    prometheus.Counter
+	TotalSent                    prometheus.Counter
+	TotalReceived                prometheus.Counter
+	TotalErrors                  prometheus.Counter
+	TotalReplicated              prometheus.Counter
+	TotalReplicatedError         prometheus.Counter
+	TotalSendAttempts            prometheus.Counter
+	TotalFailedSendAttempts      prometheus.Counter
+	TotalFailedCacheHits         prometheus.Counter
+	TotalInvalidReceiptSignature prometheus.Counter
+	PeersTriedPerPush            prometheus.HistogramVec
+	ReceiptRTT                   prometheus.Histogram
+	ReplicasStored               prometheus.Histogram
+	TotalInvalidChunkSize        prometheus.Counter
+	TotalSentBytes               prometheus.Counter
+	TotalReceivedBytes           prometheus.Counter
+	TotalReplicationSkipped      prometheus.Counter
+	TotalInvalidSOC              prometheus.Counter
+	TotalReceiptCacheHits        prometheus.Counter
+	TotalReceiptCacheMisses      prometheus.Counter
+	TotalMaxHopsExceeded         prometheus.Counter
+	TotalReceiptsOutsideDepth    prometheus.Counter
+	ReserveWaitDuration          prometheus.Histogram
+	TotalReserveFailures         prometheus.Counter
+	ChunkDataSize                prometheus.Histogram
+	TotalCachedOnForward         prometheus.Counter
+	TotalPeerDisconnected        prometheus.Counter
+	TotalStickyRouteHits         prometheus.Counter
+	TotalPushTimeout             prometheus.Counter
+	TotalPushCanceled            prometheus.Counter
+	TotalRejectedFull            prometheus.Counter
+	TotalReplicationBatches      prometheus.Counter
+	TotalPeersSkipped            prometheus.Counter
+	TotalStoredOnSelf            prometheus.Counter
+	TotalChunksFiltered          prometheus.Counter
+	TotalUpstreamWithinDepth     prometheus.Counter
+	DeliveriesByRole             prometheus.CounterVec
+	TotalReplicationWaitTimeouts prometheus.Counter
+	TotalTagIncrementErrors      prometheus.Counter
+	TotalSamePeerRetries         prometheus.Counter
+	TotalTrailingData            prometheus.Counter
+	TotalQueuedPutErrors         prometheus.Counter
 }
 
 func newMetrics() metrics {
@@ -72,9 +109,276 @@ func newMetrics() metrics {
 			Name:      "total_failed_cache_hits",
 			Help:      "Total FailedRequestCache hits",
 		}),
+		TotalInvalidReceiptSignature: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_invalid_receipt_signature",
+			Help:      "Total no of receipts with an invalid signature.",
+		}),
+		PeersTriedPerPush: *prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: m.Namespace,
+				Subsystem: subsystem,
+				Name:      "peers_tried_per_push",
+				Help:      "Histogram of the number of peers tried per push.",
+				Buckets:   []float64{1, 2, 3, 4, 5, 8, 16},
+			},
+			[]string{"result"},
+		),
+		ReceiptRTT: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "receipt_rtt_seconds",
+			Help:      "Histogram of the time between sending a chunk and receiving a valid receipt.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20},
+		}),
+		ReplicasStored: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "replicas_stored",
+			Help:      "Histogram of the number of neighbors that stored a replicated chunk.",
+			Buckets:   []float64{0, 1, 2, 3, 4, 5, 8},
+		}),
+		TotalInvalidChunkSize: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_invalid_chunk_size",
+			Help:      "Total no of received chunks with data larger than the maximum chunk size.",
+		}),
+		TotalSentBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_sent_bytes",
+			Help:      "Total bytes written to streams while pushing chunks.",
+		}),
+		TotalReceivedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_received_bytes",
+			Help:      "Total bytes read from streams while pushing chunks.",
+		}),
+		TotalReplicationSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_replication_skipped",
+			Help:      "Total no of chunk replications skipped due to too many concurrent replications.",
+		}),
+		TotalInvalidSOC: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_invalid_soc",
+			Help:      "Total no of received single owner chunks that are not valid.",
+		}),
+		TotalReceiptCacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_receipt_cache_hits",
+			Help:      "Total no of pushes answered with a cached receipt.",
+		}),
+		TotalReceiptCacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_receipt_cache_misses",
+			Help:      "Total no of pushes without a cached receipt.",
+		}),
+		TotalMaxHopsExceeded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_max_hops_exceeded",
+			Help:      "Total no of received deliveries rejected for exceeding the maximum number of hops.",
+		}),
+		TotalReceiptsOutsideDepth: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_receipts_outside_depth",
+			Help:      "Total no of receipts rejected for being signed outside of the neighborhood of the chunk.",
+		}),
+		ReserveWaitDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "reserve_wait_duration_seconds",
+			Help:      "Histogram of the time spent waiting for the accounting to reserve the price of a receipt.",
+			Buckets:   []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}),
+		TotalReserveFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_reserve_failures",
+			Help:      "Total no of failures to reserve the price of a receipt.",
+		}),
+		ChunkDataSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "chunk_data_size",
+			Help:      "Histogram of the size of the data of delivered chunks, including the span and the single owner chunk header.",
+			Buckets:   []float64{128, 256, 512, 1024, 2048, 3072, 4096, swarm.ChunkWithSpanSize, maxChunkDataSize},
+		}),
+		TotalCachedOnForward: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_cached_on_forward",
+			Help:      "Total no of forwarded chunks outside of depth stored locally.",
+		}),
+		TotalPeerDisconnected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_peer_disconnected",
+			Help:      "Total no of streams that could not be opened because the peer was not connected.",
+		}),
+		TotalStickyRouteHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_sticky_route_hits",
+			Help:      "Total no of pushes that were first attempted with the peer that last returned a receipt for the chunk bucket.",
+		}),
+		TotalPushTimeout: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_push_timeout",
+			Help:      "Total no of pushes that ran out of time before a receipt was received.",
+		}),
+		TotalPushCanceled: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_push_canceled",
+			Help:      "Total no of pushes that were canceled before a receipt was received.",
+		}),
+		TotalRejectedFull: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_rejected_full",
+			Help:      "Total no of deliveries rejected because the storage is full.",
+		}),
+		TotalReplicationBatches: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_replication_batches",
+			Help:      "Total no of batch streams opened to replicate coalesced chunks to a neighbor.",
+		}),
+		TotalPeersSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_peers_skipped",
+			Help:      "Total no of peers added to the skip list of a push to the closest peer.",
+		}),
+		TotalStoredOnSelf: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_stored_on_self",
+			Help:      "Total no of pushed chunks stored locally because this node is the closest to them.",
+		}),
+		TotalChunksFiltered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_chunks_filtered",
+			Help:      "Total no of chunks not stored or forwarded because the address filter does not allow them.",
+		}),
+		TotalUpstreamWithinDepth: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_upstream_within_depth",
+			Help:      "Total no of chunks forwarded by peers that reported them to be within their storage depth.",
+		}),
+		DeliveriesByRole: *prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: m.Namespace,
+				Subsystem: subsystem,
+				Name:      "deliveries_by_role",
+				Help:      "Total no of handled deliveries by the role of this node: replica, forward or terminal.",
+			},
+			[]string{"role"},
+		),
+		TotalReplicationWaitTimeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_replication_wait_timeouts",
+			Help:      "Total no of receipts returned before the minimum number of replicas stored the chunk.",
+		}),
+		TotalTagIncrementErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_tag_increment_errors",
+			Help:      "Total no of failed increments of the sent counter of the tags of pushed chunks.",
+		}),
+		TotalSamePeerRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_same_peer_retries",
+			Help:      "Total no of pushes retried to the same peer on a new stream after the stream failed.",
+		}),
+		TotalTrailingData: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_trailing_data",
+			Help:      "Total no of push streams on which peers sent data after the receipt.",
+		}),
+		TotalQueuedPutErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "total_queued_put_errors",
+			Help:      "Total no of chunks from the put queue that could not be stored.",
+		}),
 	}
 }
 
+// Recorder records the main protocol events of pushsync. By default, they
+// are recorded with the prometheus collectors returned by Metrics.
+type Recorder interface {
+	// IncSent records a chunk sent to a peer.
+	IncSent()
+	// IncReceived records a chunk received from a peer.
+	IncReceived()
+	// IncErrors records a failed delivery or replication.
+	IncErrors()
+	// IncReplicated records a chunk replicated to a neighbor.
+	IncReplicated()
+	// ObserveRTT records the time it took to receive the receipt for a
+	// chunk sent to a peer.
+	ObserveRTT(d time.Duration)
+}
+
+var _ Recorder = metrics{}
+
+func (mt metrics) IncSent()       { mt.TotalSent.Inc() }
+func (mt metrics) IncReceived()   { mt.TotalReceived.Inc() }
+func (mt metrics) IncErrors()     { mt.TotalErrors.Inc() }
+func (mt metrics) IncReplicated() { mt.TotalReplicated.Inc() }
+
+func (mt metrics) ObserveRTT(d time.Duration) {
+	mt.ReceiptRTT.Observe(d.Seconds())
+}
+
+// Metrics returns the prometheus collectors of the pushsync metrics, so that
+// they can be registered with any registry.
 func (s *PushSync) Metrics() []prometheus.Collector {
 	return m.PrometheusCollectorsFromFields(s.metrics)
 }
+
+// PushStats is a snapshot of the cumulative pushsync counters.
+type PushStats struct {
+	Sent       uint64 // chunks sent to peers
+	Received   uint64 // chunks received from peers
+	Errors     uint64 // errors while handling deliveries and replications
+	Replicated uint64 // chunks replicated to neighbors
+}
+
+// Stats returns the current values of the pushsync counters. The counters
+// are not updated if the events are recorded with a Recorder set with
+// WithMetricsRecorder.
+func (s *PushSync) Stats() PushStats {
+	return PushStats{
+		Sent:       counterValue(s.metrics.TotalSent),
+		Received:   counterValue(s.metrics.TotalReceived),
+		Errors:     counterValue(s.metrics.TotalErrors),
+		Replicated: counterValue(s.metrics.TotalReplicated),
+	}
+}
+
+// counterValue returns the current value of the counter.
+func counterValue(c prometheus.Counter) uint64 {
+	var metric dto.Metric
+	if err := c.Write(&metric); err != nil {
+		return 0
+	}
+	return uint64(metric.GetCounter().GetValue())
+}
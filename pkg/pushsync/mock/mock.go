@@ -2,10 +2,14 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Package mock provides mock implementations of the pushsync.PushSyncer
+// interface.
 package mock
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/ethersphere/bee/pkg/pushsync"
 	"github.com/ethersphere/bee/pkg/swarm"
@@ -26,3 +30,118 @@ func (s *mock) PushChunkToClosest(ctx context.Context, chunk swarm.Chunk) (*push
 func (s *mock) Close() error {
 	return nil
 }
+
+var _ pushsync.PushSyncer = (*Recorder)(nil)
+
+// Recorder is a PushSyncer that records the chunks pushed with it and
+// responds to the pushes as configured by its options. By default, it
+// returns a receipt with the address of the pushed chunk.
+type Recorder struct {
+	mtx       sync.Mutex
+	chunks    []swarm.Chunk
+	receipt   *pushsync.Receipt
+	err       error
+	delay     time.Duration
+	sendChunk func(ctx context.Context, chunk swarm.Chunk) (*pushsync.Receipt, error)
+}
+
+// NewRecorder returns a new Recorder configured with the options.
+func NewRecorder(opts ...Option) *Recorder {
+	r := new(Recorder)
+	for _, o := range opts {
+		o.apply(r)
+	}
+	return r
+}
+
+// WithReceipt sets the receipt returned for every push. Its address is
+// replaced with the address of the pushed chunk.
+func WithReceipt(receipt *pushsync.Receipt) Option {
+	return optionFunc(func(r *Recorder) {
+		r.receipt = receipt
+	})
+}
+
+// WithError sets the error returned for every push.
+func WithError(err error) Option {
+	return optionFunc(func(r *Recorder) {
+		r.err = err
+	})
+}
+
+// WithDelay sets the time that every push takes. Pushes return the error of
+// the context if it is done earlier.
+func WithDelay(d time.Duration) Option {
+	return optionFunc(func(r *Recorder) {
+		r.delay = d
+	})
+}
+
+// WithSendChunkFunc sets the function that responds to the pushes, taking
+// precedence over WithReceipt and WithError.
+func WithSendChunkFunc(f func(ctx context.Context, chunk swarm.Chunk) (*pushsync.Receipt, error)) Option {
+	return optionFunc(func(r *Recorder) {
+		r.sendChunk = f
+	})
+}
+
+// PushChunkToClosest records the chunk and responds with the configured
+// receipt or error, after the configured delay.
+func (r *Recorder) PushChunkToClosest(ctx context.Context, chunk swarm.Chunk) (*pushsync.Receipt, error) {
+	r.mtx.Lock()
+	r.chunks = append(r.chunks, chunk)
+	r.mtx.Unlock()
+
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if r.sendChunk != nil {
+		return r.sendChunk(ctx, chunk)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	receipt := new(pushsync.Receipt)
+	if r.receipt != nil {
+		*receipt = *r.receipt
+	}
+	receipt.Address = chunk.Address()
+	return receipt, nil
+}
+
+// Chunks returns the chunks pushed with the recorder, in the order of the
+// pushes.
+func (r *Recorder) Chunks() []swarm.Chunk {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	chunks := make([]swarm.Chunk, len(r.chunks))
+	copy(chunks, r.chunks)
+	return chunks
+}
+
+// Reset forgets the recorded chunks.
+func (r *Recorder) Reset() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.chunks = nil
+}
+
+func (r *Recorder) Close() error {
+	return nil
+}
+
+// Option is an option passed to NewRecorder.
+type Option interface {
+	apply(*Recorder)
+}
+
+type optionFunc func(*Recorder)
+
+func (f optionFunc) apply(r *Recorder) { f(r) }
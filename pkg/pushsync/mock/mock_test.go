@@ -0,0 +1,92 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/pushsync"
+	"github.com/ethersphere/bee/pkg/pushsync/mock"
+	testingc "github.com/ethersphere/bee/pkg/storage/testing"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+var errTest = errors.New("test error")
+
+func TestRecorder(t *testing.T) {
+	chunk := testingc.GenerateTestRandomChunk()
+
+	for _, tc := range []struct {
+		name      string
+		options   []mock.Option
+		ctx       func() (context.Context, context.CancelFunc)
+		wantPrice uint64
+		wantErr   error
+	}{
+		{
+			name: "default receipt",
+		},
+		{
+			name:      "receipt",
+			options:   []mock.Option{mock.WithReceipt(&pushsync.Receipt{Price: 10})},
+			wantPrice: 10,
+		},
+		{
+			name:    "error",
+			options: []mock.Option{mock.WithError(errTest)},
+			wantErr: errTest,
+		},
+		{
+			name: "send chunk func",
+			options: []mock.Option{mock.WithError(errTest), mock.WithSendChunkFunc(func(context.Context, swarm.Chunk) (*pushsync.Receipt, error) {
+				return &pushsync.Receipt{Address: chunk.Address(), Price: 20}, nil
+			})},
+			wantPrice: 20,
+		},
+		{
+			name:    "delay",
+			options: []mock.Option{mock.WithDelay(time.Minute)},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := mock.NewRecorder(tc.options...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.ctx != nil {
+				ctx, cancel = tc.ctx()
+			}
+			defer cancel()
+
+			receipt, err := r.PushChunkToClosest(ctx, chunk)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil {
+				if !receipt.Address.Equal(chunk.Address()) {
+					t.Errorf("got receipt address %s, want %s", receipt.Address, chunk.Address())
+				}
+				if receipt.Price != tc.wantPrice {
+					t.Errorf("got receipt price %d, want %d", receipt.Price, tc.wantPrice)
+				}
+			}
+
+			chunks := r.Chunks()
+			if len(chunks) != 1 || !chunks[0].Equal(chunk) {
+				t.Fatalf("got recorded chunks %v, want %v", chunks, chunk)
+			}
+			r.Reset()
+			if chunks := r.Chunks(); len(chunks) != 0 {
+				t.Fatalf("got %d recorded chunks after reset", len(chunks))
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// preferredPeerCandidates is the number of peers selected for a chunk among
+// which a preferred peer is selected first.
+const preferredPeerCandidates = 3
+
+// WithPreferredPeers selects one of the peers first if it is among the
+// closest candidates for a chunk returned by the peer selector. Peers that
+// are not candidates are never selected because they are preferred.
+func WithPreferredPeers(peers []swarm.Address) Option {
+	return func(ps *PushSync) {
+		ps.preferredPeers = append([]swarm.Address(nil), peers...)
+	}
+}
+
+// preferredPeerSelector selects a preferred peer among the first candidates
+// of the wrapped selector, or its first candidate if none is preferred.
+type preferredPeerSelector struct {
+	PeerSelector
+	preferred []swarm.Address
+}
+
+func (s preferredPeerSelector) Next(addr swarm.Address, skip []swarm.Address) (swarm.Address, error) {
+	first, err := s.PeerSelector.Next(addr, skip)
+	if err != nil {
+		return swarm.ZeroAddress, err
+	}
+
+	candidates := []swarm.Address{first}
+	for len(candidates) < preferredPeerCandidates {
+		peer, err := s.PeerSelector.Next(addr, append(skip[:len(skip):len(skip)], candidates...))
+		if err != nil {
+			// there are no more candidates
+			break
+		}
+		candidates = append(candidates, peer)
+	}
+
+	for _, peer := range candidates {
+		if containsAddress(s.preferred, peer) {
+			return peer, nil
+		}
+	}
+	return first, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/crypto"
+	"github.com/ethersphere/bee/pkg/p2p"
+	"github.com/ethersphere/bee/pkg/p2p/protobuf"
+	"github.com/ethersphere/bee/pkg/pushsync/pb"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// inclusionProofHeader is the name of the stream header with which the
+// sender of a delivery asks for the receipt to be returned as a
+// pb.ReceiptWithProof. Peers that support it return the header in the
+// response headers of the stream, while peers that do not know the header
+// return plain receipts.
+const inclusionProofHeader = "inclusion-proof"
+
+// ErrInvalidInclusionProof is matched by errors of pushes to peers that
+// returned an inclusion proof that does not link the chunk to its root.
+var ErrInvalidInclusionProof = errors.New("invalid inclusion proof")
+
+type inclusionProofKey struct{}
+
+// InclusionProof links a chunk into a state committed to by the storer. The
+// state is a binary Merkle tree of Keccak256 hashes with chunk addresses as
+// leaves, and the proof holds the sibling hashes on the path from the leaf
+// at Index to the Root.
+type InclusionProof struct {
+	Root     []byte
+	Index    uint64
+	Segments [][]byte
+}
+
+// Verify returns an error matching ErrInvalidInclusionProof if the proof
+// does not link the chunk with the address to the root.
+func (p *InclusionProof) Verify(addr swarm.Address) error {
+	if len(p.Segments) > 64 {
+		return fmt.Errorf("%d proof segments: %w", len(p.Segments), ErrInvalidInclusionProof)
+	}
+	h := addr.Bytes()
+	for i, segment := range p.Segments {
+		var err error
+		if p.Index>>uint(i)&1 == 0 {
+			h, err = crypto.LegacyKeccak256(append(append([]byte(nil), h...), segment...))
+		} else {
+			h, err = crypto.LegacyKeccak256(append(append([]byte(nil), segment...), h...))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(h, p.Root) {
+		return fmt.Errorf("chunk %s: %w", addr, ErrInvalidInclusionProof)
+	}
+	return nil
+}
+
+// clone returns a deep copy of the proof.
+func (p *InclusionProof) clone() *InclusionProof {
+	c := &InclusionProof{
+		Root:     append([]byte(nil), p.Root...),
+		Index:    p.Index,
+		Segments: make([][]byte, len(p.Segments)),
+	}
+	for i, segment := range p.Segments {
+		c.Segments[i] = append([]byte(nil), segment...)
+	}
+	return c
+}
+
+// InclusionProver provides the inclusion proofs of the chunks stored by this
+// node.
+type InclusionProver interface {
+	// InclusionProof returns the inclusion proof of the chunk with the
+	// address, or nil if the chunk is not in the committed state yet.
+	InclusionProof(addr swarm.Address) (*InclusionProof, error)
+}
+
+// WithInclusionProver includes the inclusion proofs of the prover in the
+// receipts for the chunks stored by this node, if the sender asked for them.
+func WithInclusionProver(p InclusionProver) Option {
+	return func(ps *PushSync) {
+		ps.inclusionProver = p
+	}
+}
+
+// WithInclusionProofs asks the peers for receipts with inclusion proofs. The
+// proofs of the returned receipts are verified and set as their
+// InclusionProof, while peers that do not support them return plain
+// receipts.
+func WithInclusionProofs(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.inclusionProofs = enabled
+	}
+}
+
+// withInclusionProof returns a copy of ctx that records whether the sender
+// of the delivery handled within it asked for an inclusion proof in headers.
+func withInclusionProof(ctx context.Context, headers p2p.Headers) context.Context {
+	if !hasInclusionProofHeader(headers) {
+		return ctx
+	}
+	return context.WithValue(ctx, inclusionProofKey{}, true)
+}
+
+// wantsInclusionProof reports whether the sender of the delivery handled
+// within ctx asked for an inclusion proof.
+func wantsInclusionProof(ctx context.Context) bool {
+	want, _ := ctx.Value(inclusionProofKey{}).(bool)
+	return want
+}
+
+// requestInclusionProof reports whether a push made within ctx asks the peer
+// for an inclusion proof, either because it is enabled on this node or
+// because the sender of the forwarded delivery asked for it.
+func (ps *PushSync) requestInclusionProof(ctx context.Context) bool {
+	return ps.inclusionProofs || wantsInclusionProof(ctx)
+}
+
+// hasInclusionProofHeader reports whether headers contain the inclusion
+// proof header. On the side of the sender of a delivery, the headers of the
+// stream are the response headers of the peer.
+func hasInclusionProofHeader(headers p2p.Headers) bool {
+	_, ok := headers[inclusionProofHeader]
+	return ok
+}
+
+// inclusionProof returns the inclusion proof of the stored chunk, or nil if
+// there is no prover or it does not have a proof for the chunk.
+func (ps *PushSync) inclusionProof(addr swarm.Address) *InclusionProof {
+	if ps.inclusionProver == nil {
+		return nil
+	}
+	p, err := ps.inclusionProver.InclusionProof(addr)
+	if err != nil {
+		ps.logger.Debugf("pushsync: inclusion proof for chunk %s: %v", addr, err)
+		return nil
+	}
+	return p
+}
+
+// receiptFromMessage returns the receipt read into a message returned by
+// newReceiptMessage, and its inclusion proof separately. The proof is nil if
+// the peer did not include one.
+func receiptFromMessage(m protobuf.Message) (*pb.ReceiptBundle, *InclusionProof) {
+	receipt, ok := m.(*pb.ReceiptWithProof)
+	if !ok {
+		return m.(*pb.ReceiptBundle), nil
+	}
+	bundle := &pb.ReceiptBundle{
+		Address:           receipt.Address,
+		Signature:         receipt.Signature,
+		Nonce:             receipt.Nonce,
+		ReplicaSignatures: receipt.ReplicaSignatures,
+		MissingReplicas:   receipt.MissingReplicas,
+	}
+	if len(receipt.Root) == 0 {
+		return bundle, nil
+	}
+	return bundle, &InclusionProof{Root: receipt.Root, Index: receipt.Index, Segments: receipt.Proof}
+}
+
+// writeReceiptWithProof writes back the receipt for the delivery handled
+// within ctx together with the inclusion proof, which may be nil.
+func writeReceiptWithProof(ctx context.Context, w protobuf.Writer, r *pb.ReceiptBundle, p *InclusionProof) error {
+	receipt := &pb.ReceiptWithProof{
+		Address:           r.Address,
+		Signature:         r.Signature,
+		Nonce:             r.Nonce,
+		ReplicaSignatures: r.ReplicaSignatures,
+		MissingReplicas:   r.MissingReplicas,
+	}
+	if p != nil {
+		receipt.Root = p.Root
+		receipt.Index = p.Index
+		receipt.Proof = p.Segments
+	}
+	return w.WriteMsgWithContext(ctx, receipt)
+}
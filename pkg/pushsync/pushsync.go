@@ -7,10 +7,15 @@
 package pushsync
 
 import (
+	"bytes"
 	"context"
+	crand "crypto/rand"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethersphere/bee/pkg/accounting"
@@ -29,73 +34,696 @@ import (
 	"github.com/ethersphere/bee/pkg/tracing"
 	lru "github.com/hashicorp/golang-lru"
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	protocolName    = "pushsync"
 	protocolVersion = "1.0.0"
 	streamName      = "pushsync"
+	batchStreamName = "pushsync-batch"
+	// receiptV2ProtocolVersion is the protocol version in which receipts
+	// also carry a nonce.
+	receiptV2ProtocolVersion = "1.1.0"
+	receiptNonceSize         = 32
 )
 
 const (
-	maxPeers    = 3
-	maxAttempts = 16
+	defaultMaxPeers = 3
+	maxAttempts     = 16
+	// maxChunkDataSize is the size of the largest valid chunk data, a single
+	// owner chunk wrapping a full content addressed chunk.
+	maxChunkDataSize = soc.IdSize + soc.SignatureSize + swarm.ChunkWithSpanSize
 )
 
 var (
 	ErrOutOfDepthReplication = errors.New("replication outside of the neighborhood")
 	ErrNoPush                = errors.New("could not push chunk")
+	ErrNoReceipt             = errors.New("no receipt received")
+	ErrClosed                = errors.New("pushsync closed")
+	ErrUnexpectedDelivery    = errors.New("unexpected delivery from peer outside of the routing path")
+	ErrReceiptOutsideDepth   = errors.New("receipt signed outside of the neighborhood")
+	ErrSOCOwnerMismatch      = errors.New("single owner chunk owner mismatch")
+	// ErrPushTimeout and ErrPushCanceled are matched by the errors of pushes
+	// that ran out of time or were canceled before a receipt was received.
+	// Such errors also match context.DeadlineExceeded and context.Canceled.
+	ErrPushTimeout  = errors.New("push timed out")
+	ErrPushCanceled = errors.New("push canceled")
+	// ErrClosestToSelf is returned when this node is the closest to the
+	// chunk and should store it itself. It wraps topology.ErrWantSelf.
+	ErrClosestToSelf = fmt.Errorf("closest to self: %w", topology.ErrWantSelf)
+	// ErrPartialPush is matched by the errors of PushChunkToClosestN when
+	// fewer receipts than requested were collected.
+	ErrPartialPush = errors.New("partial push")
 )
 
+// PushError is returned when no peer returned a valid receipt for a chunk.
+// It holds the errors of all push attempts. It matches ErrNoReceipt and
+// ErrNoPush, while errors.Is and errors.As also inspect the error of every
+// attempt. Unwrap returns the error of the last attempt.
+type PushError struct {
+	// Peers are the peers that the chunk was pushed to.
+	Peers []swarm.Address
+	// Errors are the errors of the push attempts, in the order of Peers.
+	Errors []error
+}
+
+func (e *PushError) add(peer swarm.Address, err error) {
+	e.Peers = append(e.Peers, peer)
+	e.Errors = append(e.Errors, err)
+}
+
+func (e *PushError) Error() string {
+	if len(e.Errors) == 0 {
+		return ErrNoReceipt.Error()
+	}
+	return fmt.Sprintf("%v: %d failed attempts, last: %v", ErrNoReceipt, len(e.Errors), e.Unwrap())
+}
+
+func (e *PushError) Is(target error) bool {
+	if target == ErrNoReceipt || target == ErrNoPush {
+		return true
+	}
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *PushError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *PushError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[len(e.Errors)-1]
+}
+
+// pushContextError is the error of a push that was stopped by its context.
+// It matches the sentinel in addition to the error of the context.
+type pushContextError struct {
+	sentinel error
+	err      error
+}
+
+func (e *pushContextError) Error() string {
+	return fmt.Sprintf("%v: %v", e.sentinel, e.err)
+}
+
+func (e *pushContextError) Unwrap() error {
+	return e.err
+}
+
+func (e *pushContextError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// partialPushError is the error of PushChunkToClosestN when fewer receipts
+// than requested were collected. It matches ErrPartialPush in addition to
+// the error that stopped the push.
+type partialPushError struct {
+	receipts int
+	want     int
+	err      error
+}
+
+func (e *partialPushError) Error() string {
+	return fmt.Sprintf("%v: %d of %d receipts: %v", ErrPartialPush, e.receipts, e.want, e.err)
+}
+
+func (e *partialPushError) Unwrap() error {
+	return e.err
+}
+
+func (e *partialPushError) Is(target error) bool {
+	return target == ErrPartialPush
+}
+
 type PushSyncer interface {
 	PushChunkToClosest(ctx context.Context, ch swarm.Chunk) (*Receipt, error)
 }
 
+// PeerSelector selects the peer a chunk is pushed to.
+type PeerSelector interface {
+	// Next returns the peer to push the chunk with the given address to,
+	// ignoring the peers in skip. It returns topology.ErrWantSelf if this
+	// node should store the chunk itself.
+	Next(addr swarm.Address, skip []swarm.Address) (swarm.Address, error)
+}
+
+// ChunkValidator validates the chunks delivered to this node before they are
+// stored or forwarded.
+type ChunkValidator interface {
+	// Validate returns an error if the chunk is not valid. The error should
+	// wrap swarm.ErrInvalidChunk.
+	Validate(ch swarm.Chunk) error
+}
+
 type Receipt struct {
 	Address   swarm.Address
 	Signature []byte
+	// Peer is the overlay address of the peer that returned the receipt.
+	Peer swarm.Address
+	// Proximity is the proximity order between Peer and the chunk address.
+	Proximity uint8
+	// Price is the price paid to Peer for the receipt.
+	Price uint64
+	// Nonce is the nonce generated by the signer of the receipt, which
+	// Signature signs as well. It is only set if the receipt was returned
+	// over the 1.1.0 protocol version by a storer that supports it.
+	Nonce []byte
+	// ReplicaSignatures are the signatures of the receipts of the neighbors
+	// that the storer replicated the chunk to. They are only set if replica
+	// receipts were requested with WithReplicaReceipts.
+	ReplicaSignatures [][]byte
+	// Custody reports whether Signature signs the CustodyDigest of the chunk
+	// instead of its address. It is only set if proof of custody was
+	// requested with WithProofOfCustody and supported by the peer.
+	Custody bool
+	// InclusionProof links the chunk into the state committed to by the
+	// storer. It is only set if inclusion proofs were requested with
+	// WithInclusionProofs and the storer provided one.
+	InclusionProof *InclusionProof
+	// MissingReplicas is the number of replicas that the storer was short
+	// of the minimum set with WithSynchronousReplication when it returned
+	// the receipt. It is zero if the minimum was reached or not required.
+	MissingReplicas int
 }
 
 type PushSync struct {
-	address        swarm.Address
-	streamer       p2p.StreamerDisconnecter
-	storer         storage.Putter
-	topologyDriver topology.Driver
-	tagger         *tags.Tags
-	unwrap         func(swarm.Chunk)
-	logger         logging.Logger
-	accounting     accounting.Interface
-	pricer         pricer.Interface
-	metrics        metrics
-	tracer         *tracing.Tracer
-	validStamp     func(swarm.Chunk, []byte) (swarm.Chunk, error)
-	signer         crypto.Signer
-	isFullNode     bool
-	failedRequests *failedRequestCache
+	address               swarm.Address
+	streamer              p2p.StreamerDisconnecter
+	storer                storage.Putter
+	topologyDriver        topology.Driver
+	tagger                *tags.Tags
+	unwrap                func(swarm.Chunk)
+	logger                logging.Logger
+	accounting            accounting.Interface
+	pricer                pricer.Interface
+	metrics               metrics
+	tracer                *tracing.Tracer
+	validStamp            func(swarm.Chunk, []byte) (swarm.Chunk, error)
+	signer                crypto.Signer
+	isFullNode            bool
+	failedRequests        *failedRequestCache
+	maxPeers              int
+	timeToLive            time.Duration
+	verifyReceipts        bool
+	networkID             uint64
+	replicationFactor     int
+	replicationFactorFunc func(depth uint8) int
+	quit                  chan struct{}
+	wg                    sync.WaitGroup
+	breaker               *peerCircuitBreaker
+	peerSelector          PeerSelector
+	validator             ChunkValidator
+	capacity              CapacityChecker
+	replicationBatcher    *replicationBatcher
+	proofOfCustody        bool
+	neighborPushTimeout   time.Duration
+	deduplicate           bool
+	inflight              singleflight.Group
+	strictForwarding      bool
+	receiptHook           func(chunk, peer swarm.Address, r *Receipt)
+	replicationSem        chan struct{}
+	receiptV2             bool
+	replicationJitter     time.Duration
+	randMu                sync.Mutex
+	rand                  *rand.Rand
+	outboundSem           chan struct{}
+	priceCache            *peerPriceCache
+	clock                 Clock
+	receiptCache          *receiptCache
+	maxHops               uint64
+	replicaReceipts       bool
+	requireNeighborhood   bool
+	recentFailures        *recentFailures
+	pushCancels           *pushCancels
+	deliveryAck           bool
+	slowPushThreshold     time.Duration
+	forwardCaching        bool
+	disconnectStalePeers  bool
+	stickyRoutes          *stickyRoutes
+	storeOnSelf           bool
+	recorder              Recorder
+	addressFilter         AddressFilter
+	inclusionProver       InclusionProver
+	inclusionProofs       bool
+	deliveryObserver      func(peer swarm.Address, d *pb.Delivery)
+	minReplicas           int
+	strictTags            bool
+	samePeerRetries       int
+	preferredPeers        []swarm.Address
+	putQueueDepth         int
+	wal                   WriteAheadLog
+	putQueue              chan swarm.Chunk
+	putQueueMu            sync.RWMutex
+	putQueueClosed        bool
+	queuedPutTimeout      time.Duration
+	closeOnce             sync.Once
+}
+
+// Option is a function that applies an option to a PushSync.
+type Option func(*PushSync)
+
+// WithMaxPeers sets the number of peers the originator attempts to push a
+// chunk to before giving up. Values lower than 1 are ignored and the default
+// is retained.
+func WithMaxPeers(n int) Option {
+	return func(ps *PushSync) {
+		if n < 1 {
+			return
+		}
+		ps.maxPeers = n
+	}
+}
+
+// WithRequestTTL sets the time to live of a single push request, both for
+// incoming deliveries and for each outgoing attempt. Non-positive durations
+// are ignored and the default is retained.
+func WithRequestTTL(d time.Duration) Option {
+	return func(ps *PushSync) {
+		if d <= 0 {
+			return
+		}
+		ps.timeToLive = d
+	}
+}
+
+// WithReceiptVerification enables verification of receipt signatures. The
+// network id is needed to derive the overlay address of the receipt signer.
+func WithReceiptVerification(networkID uint64) Option {
+	return func(ps *PushSync) {
+		ps.verifyReceipts = true
+		ps.networkID = networkID
+	}
+}
+
+// WithPeerCircuitBreaker excludes peers from selection for the cooldown
+// duration after maxFailures consecutive failed pushes. Non-positive values
+// disable the circuit breaker.
+func WithPeerCircuitBreaker(maxFailures int, cooldown time.Duration) Option {
+	return func(ps *PushSync) {
+		if maxFailures < 1 || cooldown <= 0 {
+			return
+		}
+		ps.breaker = newPeerCircuitBreaker(maxFailures, cooldown)
+	}
+}
+
+// WithPeerSelector sets the strategy used to select the peer a chunk is
+// pushed to. By default the closest peer to the chunk is selected.
+func WithPeerSelector(s PeerSelector) Option {
+	return func(ps *PushSync) {
+		if s == nil {
+			return
+		}
+		ps.peerSelector = s
+	}
+}
+
+// WithChunkValidator sets the validator of the chunks delivered to this
+// node. By default content addressed chunks and single owner chunks are
+// accepted.
+func WithChunkValidator(v ChunkValidator) Option {
+	return func(ps *PushSync) {
+		if v == nil {
+			return
+		}
+		ps.validator = v
+	}
+}
+
+// WithNeighborPushTimeout sets the time to wait for a receipt when a chunk is
+// replicated to a neighbor. Non-positive durations are ignored and the
+// default is retained.
+func WithNeighborPushTimeout(d time.Duration) Option {
+	return func(ps *PushSync) {
+		if d <= 0 {
+			return
+		}
+		ps.neighborPushTimeout = d
+	}
+}
+
+// WithReplicationFactor sets the number of neighbors a chunk is replicated
+// to by the storer node. Negative values are ignored and the default is
+// retained.
+func WithReplicationFactor(n int) Option {
+	return func(ps *PushSync) {
+		if n < 0 {
+			return
+		}
+		ps.replicationFactor = n
+	}
+}
+
+// WithReplicationFactorFunc sets a function that returns the number of
+// neighbors a chunk is replicated to for the current neighborhood depth. It
+// takes precedence over WithReplicationFactor.
+func WithReplicationFactorFunc(f func(depth uint8) int) Option {
+	return func(ps *PushSync) {
+		ps.replicationFactorFunc = f
+	}
+}
+
+// WithDeduplication makes concurrent pushes of chunks with the same address
+// share a single push and its result, instead of each of them pushing the
+// chunk to the network. The push is made with the context of the first
+// caller. Pushes that exclude peers are never deduplicated.
+func WithDeduplication(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.deduplicate = enabled
+	}
+}
+
+// WithStrictForwarding rejects deliveries from peers that are closer to the
+// chunk than this node, when this node is not within the neighborhood of the
+// chunk, with ErrUnexpectedDelivery. Such peers are not on the routing path
+// of the chunk and should not push it to this node.
+func WithStrictForwarding(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.strictForwarding = enabled
+	}
+}
+
+// WithReceiptHook sets a function that is called with every valid receipt
+// received for a pushed chunk. The hook is called in a separate goroutine,
+// with its own copy of the receipt, so it does not block the push.
+func WithReceiptHook(f func(chunk, peer swarm.Address, r *Receipt)) Option {
+	return func(ps *PushSync) {
+		ps.receiptHook = f
+	}
+}
+
+// WithDeliveryObserver sets a function that is called with every delivery
+// pushed to a peer towards the closest node, right before it is written to
+// the stream. The observer is called with its own copy of the delivery, so it
+// can not change what is written.
+func WithDeliveryObserver(f func(peer swarm.Address, d *pb.Delivery)) Option {
+	return func(ps *PushSync) {
+		ps.deliveryObserver = f
+	}
+}
+
+// WithMaxConcurrentReplications limits the number of replications to
+// neighbors that run at the same time across all deliveries. When the limit
+// is reached, further replications are skipped. Values lower than 1 are
+// ignored and replications are not limited.
+func WithMaxConcurrentReplications(n int) Option {
+	return func(ps *PushSync) {
+		if n < 1 {
+			return
+		}
+		ps.replicationSem = make(chan struct{}, n)
+	}
+}
+
+// WithReceiptV2 makes pushes request receipts with a nonce, using the 1.1.0
+// protocol version. The nonce is signed together with the chunk. Peers that
+// do not support it are pushed to with the 1.0.0 protocol version, as are the
+// deliveries forwarded for senders that did not request a nonce.
+func WithReceiptV2(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.receiptV2 = enabled
+	}
+}
+
+// WithReplicationJitter delays the start of every replication to a neighbor
+// by a random duration of up to max, so that replications of many chunks
+// received at the same time are spread out. Non-positive durations disable
+// the jitter.
+func WithReplicationJitter(max time.Duration) Option {
+	return func(ps *PushSync) {
+		if max <= 0 {
+			return
+		}
+		ps.replicationJitter = max
+	}
+}
+
+// WithMaxOutboundPushes limits the number of chunks that are pushed to peers
+// at the same time. When the limit is reached, pushes wait until others
+// finish. Values lower than 1 are ignored and pushes are not limited.
+func WithMaxOutboundPushes(n int) Option {
+	return func(ps *PushSync) {
+		if n < 1 {
+			return
+		}
+		ps.outboundSem = make(chan struct{}, n)
+	}
+}
+
+// WithPriceCacheTTL caches the prices returned by the pricer for a peer and
+// proximity order for the duration d, so that pushes of chunks to the same
+// peer do not compute the same price again. Cached prices of a peer are
+// dropped with NotifyPeerPrice. Non-positive durations disable the cache.
+func WithPriceCacheTTL(d time.Duration) Option {
+	return func(ps *PushSync) {
+		if d <= 0 {
+			return
+		}
+		ps.priceCache = newPeerPriceCache(d)
+	}
+}
+
+// WithDeliveryAck asks the peers that chunks are pushed to for an
+// acknowledgment as soon as they have read a delivery, before storing or
+// forwarding the chunk. Failed pushes to peers that support it then return
+// errors that match either ErrNotDelivered, if the chunk did not reach the
+// peer, or ErrDeliveredNoReceipt, if it did, but no valid receipt was
+// returned.
+func WithDeliveryAck(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.deliveryAck = enabled
+	}
+}
+
+// WithSlowPushThreshold logs a warning with the peer, the chunk and the
+// elapsed time for every push to a single peer that takes longer than d.
+// Non-positive durations, the default, disable the warning.
+func WithSlowPushThreshold(d time.Duration) Option {
+	return func(ps *PushSync) {
+		if d <= 0 {
+			return
+		}
+		ps.slowPushThreshold = d
+	}
+}
+
+// WithForwardCaching stores the chunks that are forwarded to the closest peer
+// locally, even if they are outside of the neighborhood depth of this node,
+// for better local availability at the cost of storage.
+func WithForwardCaching(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.forwardCaching = enabled
+	}
+}
+
+// WithDisconnectStalePeers disconnects the peers that streams can not be
+// opened to because they are not connected anymore, so that the topology
+// stops selecting them.
+func WithDisconnectStalePeers(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.disconnectStalePeers = enabled
+	}
+}
+
+// WithStickyRouting remembers the last peer that returned a valid receipt
+// for the chunks that share the first byte of their address, and tries it
+// first for the following pushes of such chunks, as long as it is still
+// connected.
+func WithStickyRouting(enabled bool) Option {
+	return func(ps *PushSync) {
+		if !enabled {
+			ps.stickyRoutes = nil
+			return
+		}
+		ps.stickyRoutes = new(stickyRoutes)
+	}
+}
+
+// WithReplicationBatchWindow coalesces the replications of chunks to the
+// same neighbor that are started within the window d and delivers them over a
+// single stream. Replications for senders that wait for replica receipts are
+// never batched. Non-positive durations disable batching.
+func WithReplicationBatchWindow(d time.Duration) Option {
+	return func(ps *PushSync) {
+		if d <= 0 {
+			ps.replicationBatcher = nil
+			return
+		}
+		ps.replicationBatcher = newReplicationBatcher(ps, d)
+	}
+}
+
+// WithStoreOnSelf makes PushChunkToClosest store the chunk locally and
+// return a receipt signed by this node when this node is the closest to the
+// chunk, instead of returning ErrClosestToSelf.
+func WithStoreOnSelf(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.storeOnSelf = enabled
+	}
+}
+
+// WithMetricsRecorder records the main protocol events with the recorder
+// instead of the prometheus collectors returned by Metrics, so that they can
+// be fed into other metrics pipelines.
+func WithMetricsRecorder(r Recorder) Option {
+	return func(ps *PushSync) {
+		if r == nil {
+			return
+		}
+		ps.recorder = r
+	}
+}
+
+// WithFailureMemory remembers the peers that failed to return a receipt for
+// a chunk for the duration ttl, and skips them in further pushes of the same
+// chunk, so that immediate retries of the caller do not select the same peer
+// again. Non-positive durations disable the memory.
+func WithFailureMemory(ttl time.Duration) Option {
+	return func(ps *PushSync) {
+		if ttl <= 0 {
+			return
+		}
+		ps.recentFailures = newRecentFailures(ttl)
+	}
+}
+
+// WithClock sets the clock used for timeouts, cooldowns, cache expiry and the
+// measured durations. It is meant for tests that need to control the passing
+// of time.
+func WithClock(c Clock) Option {
+	return func(ps *PushSync) {
+		if c == nil {
+			return
+		}
+		ps.clock = c
+	}
+}
+
+// WithReceiptCache keeps the receipts of up to size chunks pushed to the
+// network for the duration ttl, and returns them for pushes of the same chunk
+// instead of pushing it again. The least recently used receipts are evicted
+// first. Pushes that exclude peers never use the cache. Non-positive values
+// disable the cache.
+func WithReceiptCache(size int, ttl time.Duration) Option {
+	return func(ps *PushSync) {
+		if size < 1 || ttl <= 0 {
+			return
+		}
+		ps.receiptCache = newReceiptCache(size, ttl)
+	}
+}
+
+// WithMaxHops rejects deliveries of chunks that have been delivered more
+// than n times on their way from the originator with ErrMaxHopsExceeded, to
+// break forwarding loops. Values lower than 1 are ignored and the number of
+// hops is not limited.
+func WithMaxHops(n int) Option {
+	return func(ps *PushSync) {
+		if n < 1 {
+			return
+		}
+		ps.maxHops = uint64(n)
+	}
+}
+
+// WithReplicaReceipts makes pushes ask the storer of the chunk to return the
+// signatures of the neighbors it replicated the chunk to along with its own
+// receipt. The storer waits for the replication to finish before returning
+// the receipt.
+func WithReplicaReceipts(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.replicaReceipts = enabled
+	}
+}
+
+// WithRequireNeighborhoodReceipt rejects receipts signed by nodes outside of
+// the neighborhood of the chunk, as given by the neighborhood depth of this
+// node, with ErrReceiptOutsideDepth, in which case the chunk is pushed to the
+// next peer. The signer of the receipt is recovered with the network id set
+// with WithReceiptVerification.
+func WithRequireNeighborhoodReceipt(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.requireNeighborhood = enabled
+	}
+}
+
+// WithStrictTags fails pushes if the sent counter of the tag of the chunk can
+// not be incremented. By default, the failure is logged and the push
+// continues, as the chunk was already delivered to the peer.
+func WithStrictTags(enabled bool) Option {
+	return func(ps *PushSync) {
+		ps.strictTags = enabled
+	}
 }
 
 var defaultTTL = 20 * time.Second                     // request time to live
 var timeToWaitForPushsyncToNeighbor = 3 * time.Second // time to wait to get a receipt for a chunk
 var nPeersToPushsync = 3                              // number of peers to replicate to as receipt is sent upstream
+var incTag = (*tags.Tag).Inc                          // increments a tag counter
+var trailingDataTimeout = 100 * time.Millisecond      // time to wait for data after a receipt
 
-func New(address swarm.Address, streamer p2p.StreamerDisconnecter, storer storage.Putter, topology topology.Driver, tagger *tags.Tags, isFullNode bool, unwrap func(swarm.Chunk), validStamp func(swarm.Chunk, []byte) (swarm.Chunk, error), logger logging.Logger, accounting accounting.Interface, pricer pricer.Interface, signer crypto.Signer, tracer *tracing.Tracer) *PushSync {
+func New(address swarm.Address, streamer p2p.StreamerDisconnecter, storer storage.Putter, topology topology.Driver, tagger *tags.Tags, isFullNode bool, unwrap func(swarm.Chunk), validStamp func(swarm.Chunk, []byte) (swarm.Chunk, error), logger logging.Logger, accounting accounting.Interface, pricer pricer.Interface, signer crypto.Signer, tracer *tracing.Tracer, opts ...Option) *PushSync {
 	ps := &PushSync{
-		address:        address,
-		streamer:       streamer,
-		storer:         storer,
-		topologyDriver: topology,
-		tagger:         tagger,
-		isFullNode:     isFullNode,
-		unwrap:         unwrap,
-		logger:         logger,
-		accounting:     accounting,
-		pricer:         pricer,
-		metrics:        newMetrics(),
-		tracer:         tracer,
-		validStamp:     validStamp,
-		signer:         signer,
-		failedRequests: newFailedRequestCache(),
+		address:             address,
+		streamer:            streamer,
+		storer:              storer,
+		topologyDriver:      topology,
+		tagger:              tagger,
+		isFullNode:          isFullNode,
+		unwrap:              unwrap,
+		logger:              logger,
+		accounting:          accounting,
+		pricer:              pricer,
+		metrics:             newMetrics(),
+		tracer:              tracer,
+		validStamp:          validStamp,
+		signer:              signer,
+		failedRequests:      newFailedRequestCache(),
+		maxPeers:            defaultMaxPeers,
+		timeToLive:          defaultTTL,
+		replicationFactor:   nPeersToPushsync,
+		quit:                make(chan struct{}),
+		peerSelector:        closestPeerSelector{topology: topology, includeSelf: isFullNode},
+		neighborPushTimeout: timeToWaitForPushsyncToNeighbor,
+		rand:                rand.New(rand.NewSource(time.Now().UnixNano())),
+		clock:               realClock{},
+		pushCancels:         newPushCancels(),
+		queuedPutTimeout:    defaultQueuedPutTimeout,
+	}
+	ps.validator = cacOrSOCValidator{invalidSOC: ps.metrics.TotalInvalidSOC}
+	ps.recorder = ps.metrics
+
+	for _, o := range opts {
+		o(ps)
+	}
+
+	if len(ps.preferredPeers) > 0 {
+		ps.peerSelector = preferredPeerSelector{PeerSelector: ps.peerSelector, preferred: ps.preferredPeers}
+	}
+
+	if ps.putQueueDepth > 0 {
+		if ps.wal == nil {
+			ps.logger.Warning("pushsync: store put queue disabled without a write-ahead log")
+		} else {
+			ps.startPutQueue()
+		}
 	}
+
 	return ps
 }
 
@@ -106,107 +734,232 @@ func (s *PushSync) Protocol() p2p.ProtocolSpec {
 		StreamSpecs: []p2p.StreamSpec{
 			{
 				Name:    streamName,
-				Handler: s.handler,
+				Handler: s.handlerFor(protocolVersion),
+				Headler: s.headler,
+			},
+			{
+				Name:    batchStreamName,
+				Handler: s.batchHandlerFor(protocolVersion),
+				Headler: s.headler,
+			},
+		},
+	}
+}
+
+// Protocols returns the specifications of all supported protocol versions.
+func (s *PushSync) Protocols() []p2p.ProtocolSpec {
+	return []p2p.ProtocolSpec{
+		s.Protocol(),
+		{
+			Name:    protocolName,
+			Version: receiptV2ProtocolVersion,
+			StreamSpecs: []p2p.StreamSpec{
+				{
+					Name:    streamName,
+					Handler: s.handlerFor(receiptV2ProtocolVersion),
+					Headler: s.headler,
+				},
+				{
+					Name:    batchStreamName,
+					Handler: s.batchHandlerFor(receiptV2ProtocolVersion),
+					Headler: s.headler,
+				},
 			},
 		},
 	}
 }
 
+// handlerFor returns the handler for streams of the protocol version.
+func (ps *PushSync) handlerFor(version string) p2p.HandlerFunc {
+	return func(ctx context.Context, p p2p.Peer, stream p2p.Stream) error {
+		return ps.handler(ctx, p, stream, version)
+	}
+}
+
 // handler handles chunk delivery from other node and forwards to its destination node.
 // If the current node is the destination, it stores in the local store and sends a receipt.
-func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream) (err error) {
-	w, r := protobuf.NewWriterAndReader(stream)
-	ctx, cancel := context.WithTimeout(ctx, defaultTTL)
+func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream, version string) (err error) {
+	w, r := protobuf.NewWriter(stream), protobuf.NewReaderNamed(stream, "Delivery")
+	ctx, cancel := ps.withQuit(ctx)
+	defer cancel()
+	ctx, cancel = ps.withTimeout(ctx, ps.timeToLive)
 	defer cancel()
 	defer func() {
 		if err != nil {
-			ps.metrics.TotalErrors.Inc()
+			ps.recorder.IncErrors()
 			_ = stream.Reset()
 		} else {
 			_ = stream.FullClose()
 		}
 	}()
+	if ps.isClosed() {
+		return ErrClosed
+	}
+	if ctx, err = ps.checkHops(ctx, stream); err != nil {
+		return err
+	}
+	ctx = withReplicaReceipts(ctx, stream.Headers())
+	ctx = withCustody(ctx, stream.Headers())
+	ctx = withInclusionProof(ctx, stream.Headers())
+	if ctx, err = withSenderDepth(ctx, stream.Headers()); err != nil {
+		return err
+	}
 	var ch pb.Delivery
 	if err = r.ReadMsgWithContext(ctx, &ch); err != nil {
 		return fmt.Errorf("pushsync read delivery: %w", err)
 	}
-	ps.metrics.TotalReceived.Inc()
+	ps.recorder.IncReceived()
+	ps.metrics.ChunkDataSize.Observe(float64(len(ch.Data)))
+
+	if wantsAck(stream.Headers()) {
+		if err = w.WriteMsgWithContext(ctx, &pb.Ack{Address: ch.Address}); err != nil {
+			return fmt.Errorf("pushsync write ack: %w", err)
+		}
+	}
+
+	return ps.handleDelivery(ctx, p, w, &ch, version)
+}
+
+// deliveryRole returns the role of the node self in the delivery of the chunk
+// with the address from the peer p: "replica" if p is a full node closer to
+// the chunk, which selected self for replication, or "forward" otherwise. A
+// forwarding node that turns out to be the closest to the chunk becomes the
+// "terminal" one.
+func deliveryRole(p p2p.Peer, addr []byte, self swarm.Address) string {
+	if p.FullNode {
+		if dcmp, _ := swarm.DistanceCmp(addr, p.Address.Bytes(), self.Bytes()); dcmp == 1 {
+			return "replica"
+		}
+	}
+	return "forward"
+}
+
+// handleDelivery validates a single delivered chunk and either stores it or
+// forwards it to the closest peer, writing back the receipt to w in the
+// format of the protocol version.
+func (ps *PushSync) handleDelivery(ctx context.Context, p p2p.Peer, w protobuf.Writer, ch *pb.Delivery, version string) (err error) {
+	role := deliveryRole(p, ch.Address, ps.address)
+	ctx = withReceiptVersion(ctx, version)
+	defer func() {
+		ps.metrics.DeliveriesByRole.WithLabelValues(role).Inc()
+	}()
+
+	if l := len(ch.Data); l > maxChunkDataSize {
+		ps.metrics.TotalInvalidChunkSize.Inc()
+		return fmt.Errorf("chunk data size %d exceeds maximum %d: %w", l, maxChunkDataSize, swarm.ErrInvalidChunk)
+	}
 
 	chunk := swarm.NewChunk(swarm.NewAddress(ch.Address), ch.Data)
+	if err := ps.checkAddressFilter(chunk.Address()); err != nil {
+		return err
+	}
 	if chunk, err = ps.validStamp(chunk, ch.Stamp); err != nil {
 		return fmt.Errorf("pushsync valid stamp: %w", err)
 	}
 
-	if cac.Valid(chunk) {
-		if ps.unwrap != nil {
-			go ps.unwrap(chunk)
-		}
-	} else if !soc.Valid(chunk) {
-		return swarm.ErrInvalidChunk
+	if err := ps.validator.Validate(chunk); err != nil {
+		return err
+	}
+
+	if ps.storageFull() {
+		ps.metrics.TotalRejectedFull.Inc()
+		return ErrStorageFull
+	}
+
+	if ps.unwrap != nil {
+		go func() {
+			if cac.Valid(chunk) {
+				ps.unwrap(chunk)
+			}
+		}()
 	}
 
 	price := ps.pricer.Price(chunk.Address())
 
 	// if the peer is closer to the chunk, AND it's a full node, we were selected for replication. Return early.
-	if p.FullNode {
+	if role == "replica" {
 		bytes := chunk.Address().Bytes()
-		if dcmp, _ := swarm.DistanceCmp(bytes, p.Address.Bytes(), ps.address.Bytes()); dcmp == 1 {
-			if ps.topologyDriver.IsWithinDepth(chunk.Address()) {
-				ctxd, canceld := context.WithTimeout(context.Background(), timeToWaitForPushsyncToNeighbor)
-				defer canceld()
-
-				_, err = ps.storer.Put(ctxd, storage.ModePutSync, chunk)
-				if err != nil {
-					return fmt.Errorf("chunk store: %w", err)
-				}
+		if ps.topologyDriver.IsWithinDepth(chunk.Address()) {
+			ctxd, canceld := ps.withTimeout(context.Background(), ps.neighborPushTimeout)
+			defer canceld()
 
-				debit := ps.accounting.PrepareDebit(p.Address, price)
-				defer debit.Cleanup()
+			err = ps.put(ctxd, chunk)
+			if err != nil {
+				return fmt.Errorf("chunk store: %w", err)
+			}
 
-				// return back receipt
-				signature, err := ps.signer.Sign(bytes)
-				if err != nil {
-					return fmt.Errorf("receipt signature: %w", err)
-				}
-				receipt := pb.Receipt{Address: bytes, Signature: signature}
-				if err := w.WriteMsgWithContext(ctxd, &receipt); err != nil {
-					return fmt.Errorf("send receipt to peer %s: %w", p.Address.String(), err)
-				}
+			debit := ps.accounting.PrepareDebit(p.Address, price)
+			defer debit.Cleanup()
 
-				return debit.Apply()
+			// return back receipt
+			signature, nonce, err := ps.signReceipt(chunk, wantsCustody(ctx), version == receiptV2ProtocolVersion)
+			if err != nil {
+				return err
+			}
+			if err := writeReceipt(ctxd, w, version, bytes, signature, nonce); err != nil {
+				return fmt.Errorf("send receipt to peer %s: %w", p.Address.String(), err)
 			}
 
-			return ErrOutOfDepthReplication
+			return debit.Apply()
+		}
+
+		return ErrOutOfDepthReplication
+	}
+
+	ps.checkSenderDepth(ctx, p, chunk.Address())
+
+	if ps.strictForwarding {
+		if dcmp, _ := swarm.DistanceCmp(chunk.Address().Bytes(), p.Address.Bytes(), ps.address.Bytes()); dcmp == 1 && !ps.topologyDriver.IsWithinDepth(chunk.Address()) {
+			return ErrUnexpectedDelivery
 		}
 	}
 
 	// forwarding replication
 	storedChunk := false
-	if ps.topologyDriver.IsWithinDepth(chunk.Address()) {
+	withinDepth := ps.topologyDriver.IsWithinDepth(chunk.Address())
+	if withinDepth || ps.forwardCaching {
 		_, err = ps.storer.Put(ctx, storage.ModePutSync, chunk)
 		if err != nil {
-			ps.logger.Warningf("pushsync: within depth peer's attempt to store chunk failed: %v", err)
+			ps.logger.Warningf("pushsync: forwarding peer's attempt to store chunk failed: %v", err)
 		} else {
 			storedChunk = true
+			if !withinDepth {
+				ps.metrics.TotalCachedOnForward.Inc()
+			}
 		}
 	}
 
 	span, _, ctx := ps.tracer.StartSpanFromContext(ctx, "pushsync-handler", ps.logger, opentracing.Tag{Key: "address", Value: chunk.Address().String()})
 	defer span.Finish()
 
-	receipt, err := ps.pushToClosest(ctx, chunk, false)
+	receipt, err := ps.pushToClosest(ctx, chunk, false, nil)
 	if err != nil {
 		if errors.Is(err, topology.ErrWantSelf) {
+			// this node is the closest to the chunk and stores it
+			role = "terminal"
+
 			if !storedChunk {
-				_, err = ps.storer.Put(ctx, storage.ModePutSync, chunk)
+				err = ps.put(ctx, chunk)
 				if err != nil {
 					return fmt.Errorf("chunk store: %w", err)
 				}
 			}
 
-			count := 0
+			var (
+				count             = 0
+				replicated        int32
+				replicationWg     sync.WaitGroup
+				replicationFactor = ps.getReplicationFactor()
+				replicaMu         sync.Mutex
+				replicaSignatures [][]byte
+				replicaStored     = make(chan struct{}, replicationFactor)
+				replicationDone   = make(chan struct{})
+			)
+			replicationSpan, _, replicationCtx := ps.tracer.StartSpanFromContext(ctx, "pushsync-replication", ps.logger, opentracing.Tag{Key: "address", Value: chunk.Address().String()})
 			// Push the chunk to some peers in the neighborhood in parallel for replication.
 			// Any errors here should NOT impact the rest of the handler.
+			// The iteration over neighbors ensures that the replication factor
+			// is never larger than the number of neighbors available.
 			err = ps.topologyDriver.EachNeighbor(func(peer swarm.Address, po uint8) (bool, bool, error) {
 
 				// skip forwarding peer
@@ -214,12 +967,59 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 					return false, false, nil
 				}
 
-				if count == nPeersToPushsync {
+				if count >= replicationFactor {
 					return true, false, nil
 				}
+
+				if ps.replicationSem != nil {
+					select {
+					case ps.replicationSem <- struct{}{}:
+					default:
+						// too many replications in progress, skip the rest
+						ps.metrics.TotalReplicationSkipped.Inc()
+						return true, false, nil
+					}
+				}
+
+				// the receipt does not wait for batched replications, so they
+				// are only used if the sender does not wait for the replicas
+				if ps.replicationBatcher != nil && !wantsReplicaReceipts(ctx) {
+					replicationWg.Add(1)
+					err := ps.replicationBatcher.Add(peer, chunk, func(err error) {
+						defer replicationWg.Done()
+						if ps.replicationSem != nil {
+							defer func() { <-ps.replicationSem }()
+						}
+						if err != nil {
+							ps.logger.Tracef("pushsync replication: %v", err)
+							ps.metrics.TotalReplicatedError.Inc()
+							return
+						}
+						atomic.AddInt32(&replicated, 1)
+						replicaStored <- struct{}{}
+						ps.recorder.IncReplicated()
+						ps.incReplicatedTag(chunk)
+					})
+					if err != nil {
+						replicationWg.Done()
+						if ps.replicationSem != nil {
+							<-ps.replicationSem
+						}
+						return true, false, nil
+					}
+					count++
+					return false, false, nil
+				}
 				count++
 
+				ps.wg.Add(1)
+				replicationWg.Add(1)
 				go func(peer swarm.Address) {
+					defer ps.wg.Done()
+					defer replicationWg.Done()
+					if ps.replicationSem != nil {
+						defer func() { <-ps.replicationSem }()
+					}
 
 					var err error
 					defer func() {
@@ -227,39 +1027,48 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 							ps.logger.Tracef("pushsync replication: %v", err)
 							ps.metrics.TotalReplicatedError.Inc()
 						} else {
-							ps.metrics.TotalReplicated.Inc()
+							atomic.AddInt32(&replicated, 1)
+							replicaStored <- struct{}{}
+							ps.recorder.IncReplicated()
 						}
 					}()
 
 					// price for neighborhood replication
-					receiptPrice := ps.pricer.PeerPrice(peer, chunk.Address())
+					receiptPrice := ps.peerPrice(peer, chunk.Address())
 
-					ctx, cancel := context.WithTimeout(context.Background(), timeToWaitForPushsyncToNeighbor)
+					// replication should not be cut off when the handler returns,
+					// so only the values of the handler context are kept
+					ctx, cancel := ps.withQuit(detachedContext{parent: replicationCtx})
 					defer cancel()
 
-					err = ps.accounting.Reserve(ctx, peer, receiptPrice)
-					if err != nil {
-						err = fmt.Errorf("reserve balance for peer %s: %w", peer.String(), err)
+					if err = ps.waitReplicationJitter(ctx); err != nil {
+						return
+					}
+
+					ctx, cancel = ps.withTimeout(ctx, ps.neighborPushTimeout)
+					defer cancel()
+
+					if err = ps.reserve(ctx, peer, receiptPrice); err != nil {
 						return
 					}
 					defer ps.accounting.Release(peer, receiptPrice)
 
-					streamer, err := ps.streamer.NewStream(ctx, peer, nil, protocolName, protocolVersion, streamName)
+					streamer, err := ps.streamer.NewStream(ctx, peer, makeHopsHeaders(ctx), protocolName, protocolVersion, streamName)
 					if err != nil {
-						err = fmt.Errorf("new stream for peer %s: %w", peer.String(), err)
+						err = ps.newStreamError(peer, err)
 						return
 					}
 
 					defer func() {
 						if err != nil {
-							ps.metrics.TotalErrors.Inc()
+							ps.recorder.IncErrors()
 							_ = streamer.Reset()
 						} else {
 							_ = streamer.FullClose()
 						}
 					}()
 
-					w, r := protobuf.NewWriterAndReader(streamer)
+					w, r := protobuf.NewWriter(streamer), protobuf.NewReaderNamed(streamer, "Receipt")
 					stamp, err := chunk.Stamp().MarshalBinary()
 					if err != nil {
 						return
@@ -280,11 +1089,20 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 
 					if !chunk.Address().Equal(swarm.NewAddress(receipt.Address)) {
 						// if the receipt is invalid, give up
+						err = fmt.Errorf("invalid receipt from peer %s", peer.String())
 						return
 					}
 
 					err = ps.accounting.Credit(peer, receiptPrice)
+					if err != nil {
+						return
+					}
 
+					replicaMu.Lock()
+					replicaSignatures = append(replicaSignatures, receipt.Signature)
+					replicaMu.Unlock()
+
+					ps.incReplicatedTag(chunk)
 				}(peer)
 
 				return false, false, nil
@@ -293,17 +1111,54 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 				ps.logger.Tracef("pushsync replication closest peer: %w", err)
 			}
 
-			signature, err := ps.signer.Sign(ch.Address)
-			if err != nil {
-				return fmt.Errorf("receipt signature: %w", err)
+			// record the outcome of the replication once all replicas are done
+			ps.wg.Add(1)
+			go func(attempted int) {
+				defer ps.wg.Done()
+				replicationWg.Wait()
+				close(replicationDone)
+
+				stored := atomic.LoadInt32(&replicated)
+				ps.metrics.ReplicasStored.Observe(float64(stored))
+				replicationSpan.SetTag("attempted", attempted)
+				replicationSpan.SetTag("stored", stored)
+				replicationSpan.Finish()
+			}(count)
+
+			bundle := &pb.ReceiptBundle{Address: chunk.Address().Bytes()}
+			if ps.minReplicas > 0 {
+				if missing := ps.waitMinReplicas(ctx, replicaStored, replicationDone); missing > 0 {
+					ps.metrics.TotalReplicationWaitTimeouts.Inc()
+					ps.logger.Debugf("pushsync: chunk %s: receipt returned with %d of %d replicas missing", chunk.Address(), missing, ps.minReplicas)
+					bundle.MissingReplicas = uint32(missing)
+				}
+			}
+
+			if wantsReplicaReceipts(ctx) {
+				// the sender waits for the receipts of the replicas
+				select {
+				case <-replicationDone:
+				case <-ctx.Done():
+				}
+				replicaMu.Lock()
+				bundle.ReplicaSignatures = append(bundle.ReplicaSignatures, replicaSignatures...)
+				replicaMu.Unlock()
+			}
+
+			bundle.Signature, bundle.Nonce, err = ps.signReceipt(chunk, wantsCustody(ctx), version == receiptV2ProtocolVersion)
+			if err != nil {
+				return err
 			}
 
 			// return back receipt
 			debit := ps.accounting.PrepareDebit(p.Address, price)
 			defer debit.Cleanup()
 
-			receipt := pb.Receipt{Address: chunk.Address().Bytes(), Signature: signature}
-			if err := w.WriteMsgWithContext(ctx, &receipt); err != nil {
+			var proof *InclusionProof
+			if wantsInclusionProof(ctx) {
+				proof = ps.inclusionProof(chunk.Address())
+			}
+			if err := writeDeliveryReceipt(ctx, w, version, bundle, proof); err != nil {
 				return fmt.Errorf("send receipt to peer %s: %w", p.Address.String(), err)
 			}
 
@@ -313,112 +1168,752 @@ func (ps *PushSync) handler(ctx context.Context, p p2p.Peer, stream p2p.Stream)
 
 	}
 
+	if wantsCustody(ctx) && !receipt.Custody {
+		return fmt.Errorf("handler: receipt from peer %s: %w", receipt.Peer, errNoCustody)
+	}
+
 	debit := ps.accounting.PrepareDebit(p.Address, price)
 	defer debit.Cleanup()
 
 	// pass back the receipt
-	if err := w.WriteMsgWithContext(ctx, receipt); err != nil {
+	if err := writeDeliveryReceipt(ctx, w, version, &pb.ReceiptBundle{
+		Address:           receipt.Address.Bytes(),
+		Signature:         receipt.Signature,
+		Nonce:             receipt.Nonce,
+		ReplicaSignatures: receipt.ReplicaSignatures,
+		MissingReplicas:   uint32(receipt.MissingReplicas),
+	}, receipt.InclusionProof); err != nil {
 		return fmt.Errorf("send receipt to peer %s: %w", p.Address.String(), err)
 	}
 
 	return debit.Apply()
 }
 
+// waitReplicationJitter waits for a random duration of up to the configured
+// replication jitter, or until the context is done.
+func (ps *PushSync) waitReplicationJitter(ctx context.Context) error {
+	if ps.replicationJitter <= 0 {
+		return nil
+	}
+
+	ps.randMu.Lock()
+	d := time.Duration(ps.rand.Int63n(int64(ps.replicationJitter)))
+	ps.randMu.Unlock()
+
+	select {
+	case <-ps.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeReceipt writes the receipt in the format of the protocol version. The
+// nonce is only written with the 1.1.0 version.
+func writeReceipt(ctx context.Context, w protobuf.Writer, version string, address, signature, nonce []byte) error {
+	if version != receiptV2ProtocolVersion {
+		return w.WriteMsgWithContext(ctx, &pb.Receipt{Address: address, Signature: signature})
+	}
+	return w.WriteMsgWithContext(ctx, &pb.ReceiptV2{Address: address, Signature: signature, Nonce: nonce})
+}
+
+type receiptVersionKey struct{}
+
+// withReceiptVersion returns a copy of ctx that records the protocol version
+// of the delivery handled within it, in which its receipt is written back.
+func withReceiptVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, receiptVersionKey{}, version)
+}
+
+// requestReceiptV2 reports whether a push made within ctx requests a receipt
+// with a nonce. Pushes that forward a delivery only request it if the sender
+// of the delivery accepts it too, as the nonce is signed by the storer and
+// receipts of the 1.0.0 version can not carry it back.
+func (ps *PushSync) requestReceiptV2(ctx context.Context) bool {
+	if !ps.receiptV2 {
+		return false
+	}
+	version, ok := ctx.Value(receiptVersionKey{}).(string)
+	return !ok || version == receiptV2ProtocolVersion
+}
+
+// signReceipt signs the receipt for the chunk, over its CustodyDigest if
+// custody is true and over its address otherwise. If nonce is true, the
+// receipt gets a new nonce, which is signed together with the digest as
+// ReceiptNonceDigest defines.
+func (ps *PushSync) signReceipt(ch swarm.Chunk, custody, nonce bool) (signature, n []byte, err error) {
+	digest, err := receiptDigest(ch, custody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("receipt digest: %w", err)
+	}
+	if nonce {
+		if n, err = newReceiptNonce(); err != nil {
+			return nil, nil, err
+		}
+		if digest, err = ReceiptNonceDigest(digest, n); err != nil {
+			return nil, nil, fmt.Errorf("receipt digest: %w", err)
+		}
+	}
+	if signature, err = ps.signer.Sign(digest); err != nil {
+		return nil, nil, fmt.Errorf("receipt signature: %w", err)
+	}
+	return signature, n, nil
+}
+
+// newReceiptNonce generates a random nonce for a receipt.
+func newReceiptNonce() ([]byte, error) {
+	nonce := make([]byte, receiptNonceSize)
+	if _, err := crand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("receipt nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// newReceiptMessage returns the message that a receipt is read into, with an
+// inclusion proof if proof is set. Receipts are otherwise read as a bundle.
+// The bundle shares its field numbers with the receipts of all protocol
+// versions, so it also decodes the plain receipts, and it carries the
+// replicas that the storer missed even if replica receipts were not
+// requested.
+func newReceiptMessage(proof bool) protobuf.Message {
+	if proof {
+		return new(pb.ReceiptWithProof)
+	}
+	return new(pb.ReceiptBundle)
+}
+
+// closestPeerError wraps the error returned by peer selection, replacing
+// topology.ErrWantSelf with ErrClosestToSelf.
+func closestPeerError(err error) error {
+	if errors.Is(err, topology.ErrWantSelf) {
+		return ErrClosestToSelf
+	}
+	return fmt.Errorf("closest peer: %w", err)
+}
+
+// validateSOC checks that the chunk is a single owner chunk with the address
+// derived from its id and owner.
+func validateSOC(ch swarm.Chunk) (*soc.SOC, error) {
+	s, err := soc.FromChunk(ch)
+	if err != nil {
+		return nil, fmt.Errorf("single owner chunk %s: %v: %w", ch.Address(), err, swarm.ErrInvalidChunk)
+	}
+
+	sch, err := s.Chunk()
+	if err != nil {
+		return nil, fmt.Errorf("single owner chunk %s: %v: %w", ch.Address(), err, swarm.ErrInvalidChunk)
+	}
+
+	if !sch.Address().Equal(ch.Address()) {
+		return nil, fmt.Errorf("single owner chunk address %s does not match derived address %s: %w", ch.Address(), sch.Address(), swarm.ErrInvalidChunk)
+	}
+
+	return s, nil
+}
+
+type sentTagKey struct{}
+
+// withSentTagOnce returns a copy of ctx within which the sent counter of the
+// tag of a chunk is incremented only once, however many times the chunk is
+// delivered over new streams within it.
+func withSentTagOnce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sentTagKey{}, new(int32))
+}
+
+// withoutSentTag returns a copy of ctx within which the sent counter of the
+// tag of a chunk is never incremented, as for replications to neighbors.
+func withoutSentTag(ctx context.Context) context.Context {
+	sent := int32(1)
+	return context.WithValue(ctx, sentTagKey{}, &sent)
+}
+
+// incSentTag increments the sent counter of the tag of the chunk, if it has
+// one and the counter was not incremented within ctx yet. Failures to
+// increment it are only returned with WithStrictTags.
+func (ps *PushSync) incSentTag(ctx context.Context, ch swarm.Chunk) error {
+	if once, ok := ctx.Value(sentTagKey{}).(*int32); ok && !atomic.CompareAndSwapInt32(once, 0, 1) {
+		return nil
+	}
+
+	// if you manage to get a tag, just increment the respective counter
+	t, err := ps.tagger.Get(ch.TagID())
+	if err != nil || t == nil {
+		return nil
+	}
+	if err := incTag(t, tags.StateSent); err != nil {
+		if ps.strictTags {
+			return fmt.Errorf("tag %d increment: %v", ch.TagID(), err)
+		}
+		ps.metrics.TotalTagIncrementErrors.Inc()
+		ps.logger.Debugf("pushsync: tag %d increment: %v", ch.TagID(), err)
+	}
+	return nil
+}
+
+// incReplicatedTag increments the replicated counter of the tag of the
+// chunk, if it has one.
+func (ps *PushSync) incReplicatedTag(chunk swarm.Chunk) {
+	// if you manage to get a tag, just increment the respective counter
+	t, err := ps.tagger.Get(chunk.TagID())
+	if err == nil && t != nil {
+		if err = t.Inc(tags.StateReplicated); err != nil {
+			ps.logger.Debugf("pushsync replication: tag %d increment: %v", chunk.TagID(), err)
+		}
+	}
+}
+
+// getReplicationFactor returns the number of neighbors a chunk is replicated to
+// for the current neighborhood depth.
+func (ps *PushSync) getReplicationFactor() int {
+	if ps.replicationFactorFunc == nil {
+		return ps.replicationFactor
+	}
+	n := ps.replicationFactorFunc(ps.topologyDriver.NeighborhoodDepth())
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
 // PushChunkToClosest sends chunk to the closest peer by opening a stream. It then waits for
 // a receipt from that peer and returns error or nil based on the receiving and
-// the validity of the receipt.
+// the validity of the receipt. If this node is the closest to the chunk and
+// WithStoreOnSelf is enabled, the chunk is stored locally instead.
 func (ps *PushSync) PushChunkToClosest(ctx context.Context, ch swarm.Chunk) (*Receipt, error) {
-	r, err := ps.pushToClosest(ctx, ch, true)
+	receipt, err := ps.PushChunkToClosestExcluding(ctx, ch, nil)
+	if ps.storeOnSelf && errors.Is(err, ErrClosestToSelf) {
+		return ps.storeOnSelfReceipt(ctx, ch)
+	}
+	return receipt, err
+}
+
+// storeOnSelfReceipt stores the chunk locally and returns a receipt signed by
+// this node, in the same form as the receipts of the peers.
+func (ps *PushSync) storeOnSelfReceipt(ctx context.Context, ch swarm.Chunk) (*Receipt, error) {
+	if err := ps.checkAddressFilter(ch.Address()); err != nil {
+		return nil, err
+	}
+	if _, err := ps.storer.Put(ctx, storage.ModePutSync, ch); err != nil {
+		return nil, fmt.Errorf("chunk store: %w", err)
+	}
+
+	signature, nonce, err := ps.signReceipt(ch, ps.proofOfCustody, ps.receiptV2)
 	if err != nil {
 		return nil, err
 	}
-	return &Receipt{
-		Address:   swarm.NewAddress(r.Address),
-		Signature: r.Signature}, nil
+
+	receipt := newReceipt(&pb.ReceiptBundle{Address: ch.Address().Bytes(), Signature: signature, Nonce: nonce}, ps.address, ch.Address(), 0)
+	receipt.Custody = ps.proofOfCustody
+	ps.metrics.TotalStoredOnSelf.Inc()
+	ps.callReceiptHook(ch.Address(), ps.address, receipt)
+	return receipt, nil
+}
+
+// PushChunkToClosestExcluding sends chunk to the closest peer like
+// PushChunkToClosest does, but never selects any of the peers in skip.
+func (ps *PushSync) PushChunkToClosestExcluding(ctx context.Context, ch swarm.Chunk, skip []swarm.Address) (*Receipt, error) {
+	if ps.receiptCache == nil || len(skip) > 0 {
+		return ps.pushChunkToClosest(ctx, ch, skip)
+	}
+
+	if receipt, ok := ps.receiptCache.Get(ch.Address(), ps.clock.Now()); ok {
+		ps.metrics.TotalReceiptCacheHits.Inc()
+		return receipt, nil
+	}
+	ps.metrics.TotalReceiptCacheMisses.Inc()
+
+	receipt, err := ps.pushChunkToClosest(ctx, ch, nil)
+	if err != nil {
+		return nil, err
+	}
+	ps.receiptCache.Add(ch.Address(), receipt, ps.clock.Now())
+	return receipt, nil
 }
 
-func (ps *PushSync) pushToClosest(ctx context.Context, ch swarm.Chunk, retryAllowed bool) (*pb.Receipt, error) {
-	span, logger, ctx := ps.tracer.StartSpanFromContext(ctx, "push-closest", ps.logger, opentracing.Tag{Key: "address", Value: ch.Address().String()})
+// PushChunkToClosestN pushes the chunk to the closest peers until n of them
+// returned a valid receipt, pushing to every peer at most once, and returns
+// the receipts. Every push is made like the pushes of PushChunkToClosest,
+// excluding the peers that already returned a receipt. If the peers are
+// exhausted or a push fails after some but fewer than n receipts were
+// collected, the receipts are returned together with an error that matches
+// ErrPartialPush and the error of the failed push. If no receipt was
+// collected, only the error is returned. Values of n lower than 1 are
+// treated as 1.
+func (ps *PushSync) PushChunkToClosestN(ctx context.Context, ch swarm.Chunk, n int) ([]*Receipt, error) {
+	if n < 1 {
+		n = 1
+	}
+
+	receipts := make([]*Receipt, 0, n)
+	peers := make([]swarm.Address, 0, n)
+	for len(receipts) < n {
+		receipt, err := ps.PushChunkToClosestExcluding(ctx, ch, peers)
+		if err != nil {
+			if len(receipts) == 0 {
+				return nil, err
+			}
+			return receipts, &partialPushError{receipts: len(receipts), want: n, err: err}
+		}
+		receipts = append(receipts, receipt)
+		peers = append(peers, receipt.Peer)
+	}
+	return receipts, nil
+}
+
+// PushResult is the outcome of a push made with PushChunkToClosestAsync.
+type PushResult struct {
+	Receipt *Receipt
+	Err     error
+}
+
+// PushChunkToClosestAsync pushes the chunk like PushChunkToClosest does, but
+// returns immediately with a channel that receives the result of the push
+// once it completes. The channel is buffered, so the push does not block if
+// the result is never received.
+func (ps *PushSync) PushChunkToClosestAsync(ctx context.Context, ch swarm.Chunk) <-chan PushResult {
+	c := make(chan PushResult, 1)
+	go func() {
+		receipt, err := ps.PushChunkToClosest(ctx, ch)
+		c <- PushResult{Receipt: receipt, Err: err}
+	}()
+	return c
+}
+
+// pushChunkToClosest pushes the chunk to the closest peer, sharing the push
+// with concurrent pushes of the same chunk if deduplication is enabled.
+func (ps *PushSync) pushChunkToClosest(ctx context.Context, ch swarm.Chunk, skip []swarm.Address) (*Receipt, error) {
+	if !ps.deduplicate || len(skip) > 0 {
+		return ps.pushToClosest(ctx, ch, true, skip)
+	}
+
+	v, err, shared := ps.inflight.Do(ch.Address().ByteString(), func() (interface{}, error) {
+		return ps.pushToClosest(ctx, ch, true, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := v.(*Receipt)
+	if shared {
+		// every caller gets its own receipt
+		receipt = receipt.clone()
+	}
+	return receipt, nil
+}
+
+// PushSOCToClosest pushes the single owner chunk to the closest peer like
+// PushChunkToClosest does, after checking that it is a valid single owner
+// chunk signed by expectedOwner, the ethereum address of the owner. Chunks
+// of other owners are not pushed and ErrSOCOwnerMismatch is returned, which
+// catches single owner chunks signed with the wrong key before they are
+// pushed.
+func (ps *PushSync) PushSOCToClosest(ctx context.Context, ch swarm.Chunk, expectedOwner []byte) (*Receipt, error) {
+	s, err := validateSOC(ch)
+	if err != nil {
+		return nil, err
+	}
+	if owner := s.OwnerAddress(); !bytes.Equal(owner, expectedOwner) {
+		return nil, fmt.Errorf("single owner chunk %s signed by %x, expected %x: %w", ch.Address(), owner, expectedOwner, ErrSOCOwnerMismatch)
+	}
+	return ps.PushChunkToClosest(ctx, ch)
+}
+
+// Cancel cancels the pushes of the chunk with the address addr to its closest
+// peers that are in flight, which then return context.Canceled. Pushes that
+// are shared by deduplication are cancelled for all of their callers.
+// Cancelling is best-effort, as a receipt may already be on its way, and it
+// is a no-op if no push of the chunk is in flight.
+func (ps *PushSync) Cancel(addr swarm.Address) {
+	ps.pushCancels.Cancel(addr)
+}
+
+// PushChunkToPeer pushes the chunk to the given peer, regardless of whether
+// it is the closest peer to the chunk, and returns its receipt. The push is
+// attempted only once and the receipt is validated the same way as the
+// receipts of pushes to the closest peer.
+func (ps *PushSync) PushChunkToPeer(ctx context.Context, peer swarm.Address, ch swarm.Chunk) (*Receipt, error) {
+	if ps.isClosed() {
+		return nil, ErrClosed
+	}
+
+	ctx, cancel := ps.withQuit(ctx)
+	defer cancel()
+	ctx, cancel = ps.withTimeout(ctx, ps.timeToLive)
+	defer cancel()
+
+	ps.metrics.TotalSendAttempts.Inc()
+	receipt, attempted, err := ps.pushPeer(ctx, peer, ch)
+	if err != nil {
+		if attempted {
+			ps.metrics.TotalFailedSendAttempts.Inc()
+		}
+		return nil, err
+	}
+
+	ps.callReceiptHook(ch.Address(), peer, receipt)
+	return receipt, nil
+}
+
+// ClosestPeer returns the peer that a chunk with the given address would be
+// pushed to and the price of its receipt, without sending the chunk.
+func (ps *PushSync) ClosestPeer(ctx context.Context, addr swarm.Address) (swarm.Address, uint64, error) {
+	if ps.isClosed() {
+		return swarm.ZeroAddress, 0, ErrClosed
+	}
+
+	var skipPeers []swarm.Address
+	if ps.breaker != nil {
+		skipPeers = append(skipPeers, ps.breaker.OpenPeers(ps.clock.Now())...)
+	}
+
+	for i := maxAttempts; i > 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return swarm.ZeroAddress, 0, err
+		}
+
+		peer, err := ps.peerSelector.Next(addr, skipPeers)
+		if err != nil {
+			return swarm.ZeroAddress, 0, closestPeerError(err)
+		}
+		if !ps.failedRequests.Useful(peer, addr) {
+			skipPeers = append(skipPeers, peer)
+			continue
+		}
+
+		return peer, ps.peerPrice(peer, addr), nil
+	}
+
+	return swarm.ZeroAddress, 0, fmt.Errorf("closest peer: %w", topology.ErrNotFound)
+}
+
+func (ps *PushSync) pushToClosest(ctx context.Context, ch swarm.Chunk, retryAllowed bool, skip []swarm.Address) (*Receipt, error) {
+	if ps.isClosed() {
+		return nil, ErrClosed
+	}
+
+	ctx, cancel := ps.withQuit(ctx)
+	defer cancel()
+	cancelID := ps.pushCancels.Add(ch.Address(), cancel)
+	defer ps.pushCancels.Remove(ch.Address(), cancelID)
+
+	if ps.outboundSem != nil {
+		select {
+		case ps.outboundSem <- struct{}{}:
+			defer func() { <-ps.outboundSem }()
+		case <-ps.quit:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ps.contextError(ctx.Err())
+		}
+	}
+
+	span, logger, ctx := ps.tracer.StartSpanFromContext(ctx, "push-closest", ps.logger)
 	defer span.Finish()
+	// boxing the address for the tag allocates, so it is only done for
+	// spans that are recorded
+	if _, noop := span.Tracer().(opentracing.NoopTracer); !noop {
+		span.SetTag("address", ch.Address().String())
+	}
 
 	var (
-		skipPeers      []swarm.Address
 		allowedRetries = 1
-		resultC        = make(chan *pushResult)
-		includeSelf    = ps.isFullNode
+		resultC        = make(chan pushResult)
+		pushErr        PushError // returned only if no receipt is received
+		peersTried     int
 	)
 
 	if retryAllowed {
 		// only originator retries
-		allowedRetries = maxPeers
+		allowedRetries = ps.maxPeers
 	}
 
+	// copy the peers to skip so that the caller's slice is not modified
+	unavailable := ps.unavailablePeers(ch.Address())
+	ps.metrics.TotalPeersSkipped.Add(float64(len(unavailable)))
+	skipPeers := make([]swarm.Address, 0, len(skip)+len(unavailable)+maxAttempts)
+	skipPeers = append(append(skipPeers, skip...), unavailable...)
+
 	for i := maxAttempts; allowedRetries > 0 && i > 0; i-- {
-		// find the next closest peer
-		peer, err := ps.topologyDriver.ClosestPeer(ch.Address(), includeSelf, skipPeers...)
+		// find the next closest peer, starting with the sticky one
+		peer, err := ps.nextPeer(ch.Address(), skipPeers, i == maxAttempts)
 		if err != nil {
 			// ClosestPeer can return ErrNotFound in case we are not connected to any peers
 			// in which case we should return immediately.
 			// if ErrWantSelf is returned, it means we are the closest peer.
-			return nil, fmt.Errorf("closest peer: %w", err)
+			// If peers were already attempted, it means we ran out of them.
+			if errors.Is(err, topology.ErrNotFound) && len(pushErr.Errors) > 0 {
+				break
+			}
+			return nil, closestPeerError(err)
 		}
+		skipPeers = append(skipPeers, peer)
+		ps.metrics.TotalPeersSkipped.Inc()
 		if !ps.failedRequests.Useful(peer, ch.Address()) {
-			skipPeers = append(skipPeers, peer)
 			ps.metrics.TotalFailedCacheHits.Inc()
 			continue
 		}
-		skipPeers = append(skipPeers, peer)
 		ps.metrics.TotalSendAttempts.Inc()
+		peersTried++
 
-		go func(peer swarm.Address, ch swarm.Chunk) {
-			ctxd, canceld := context.WithTimeout(ctx, defaultTTL)
-			defer canceld()
+		go ps.pushAttempt(ctx, logger, peer, ch, resultC)
 
-			r, attempted, err := ps.pushPeer(ctxd, peer, ch)
+		select {
+		case r := <-resultC:
 			// attempted is true if we get past accounting and actually attempt
 			// to send the request to the peer. If we dont get past accounting, we
 			// should not count the retry and try with a different peer again
-			if attempted {
+			if r.attempted {
 				allowedRetries--
 			}
-			if err != nil {
-				logger.Debugf("could not push to peer %s: %v", peer, err)
-				resultC <- &pushResult{err: err, attempted: attempted}
-				return
-			}
-			select {
-			case resultC <- &pushResult{receipt: r}:
-			case <-ctx.Done():
-			}
-		}(peer, ch)
-
-		select {
-		case r := <-resultC:
 			if r.receipt != nil {
-				ps.failedRequests.RecordSuccess(peer, ch.Address())
+				ps.recordPushSuccess(peer, ch.Address())
+				ps.metrics.PeersTriedPerPush.WithLabelValues("success").Observe(float64(peersTried))
+				ps.callReceiptHook(ch.Address(), peer, r.receipt)
 				return r.receipt, nil
 			}
+			if r.err != nil && ctx.Err() != nil {
+				// the push ran out of time or was canceled, which is
+				// not the fault of the peer
+				return nil, ps.contextError(ctx.Err())
+			}
+			if r.err != nil {
+				pushErr.add(peer, r.err)
+			}
 			if r.err != nil && r.attempted {
-				ps.failedRequests.RecordFailure(peer, ch.Address())
-				ps.metrics.TotalFailedSendAttempts.Inc()
+				ps.recordPushFailure(peer, ch.Address())
 			}
 			// proceed to retrying if applicable
+		case <-ps.quit:
+			return nil, ErrClosed
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, ps.contextError(ctx.Err())
+		}
+	}
+
+	ps.metrics.PeersTriedPerPush.WithLabelValues("failure").Observe(float64(peersTried))
+
+	return nil, &PushError{Peers: pushErr.Peers, Errors: pushErr.Errors}
+}
+
+// pushAttempt pushes the chunk to the peer within the request time to live,
+// retrying on new streams to the same peer, and sends the result to resultC
+// unless ctx is done.
+func (ps *PushSync) pushAttempt(ctx context.Context, logger *logrus.Entry, peer swarm.Address, ch swarm.Chunk, resultC chan<- pushResult) {
+	ctxd, canceld := ps.withTimeout(ctx, ps.timeToLive)
+	defer canceld()
+	// retries to the same peer count the chunk as sent once
+	ctxd = withSentTagOnce(ctxd)
+
+	start := ps.clock.Now()
+	r, attempted, err := ps.pushPeer(ctxd, peer, ch)
+	for retries := ps.samePeerRetries; retries > 0 && isStreamFailure(err) && ctxd.Err() == nil; retries-- {
+		logger.Debugf("pushsync: retry push to peer %s on a new stream: %v", peer, err)
+		ps.metrics.TotalSamePeerRetries.Inc()
+		r, attempted, err = ps.pushPeer(ctxd, peer, ch)
+	}
+	if elapsed := ps.clock.Now().Sub(start); ps.slowPushThreshold > 0 && elapsed > ps.slowPushThreshold {
+		logger.WithFields(logrus.Fields{
+			"peer":    peer,
+			"chunk":   ch.Address(),
+			"elapsed": elapsed,
+		}).Warning("pushsync: slow push")
+	}
+	if err != nil {
+		logger.Debugf("could not push to peer %s: %v", peer, err)
+		r = nil
+	}
+
+	select {
+	case resultC <- pushResult{receipt: r, err: err, attempted: attempted}:
+	case <-ctx.Done():
+	}
+}
+
+// unavailablePeers returns the peers that the chunk with the given address is
+// not pushed to: the ones with an open circuit breaker and the ones that
+// recently failed to push it.
+func (ps *PushSync) unavailablePeers(addr swarm.Address) []swarm.Address {
+	var peers []swarm.Address
+	if ps.breaker != nil {
+		peers = append(peers, ps.breaker.OpenPeers(ps.clock.Now())...)
+	}
+	if ps.recentFailures != nil {
+		peers = append(peers, ps.recentFailures.Peers(addr, ps.clock.Now())...)
+	}
+	return peers
+}
+
+// selectPeer returns the peer to push the chunk with the given address to,
+// selected the same way as by pushToClosest. It ignores the peers in skip and
+// the unavailable ones, and the peers that the chunk recently failed to be
+// pushed to too often.
+func (ps *PushSync) selectPeer(addr swarm.Address, skip []swarm.Address) (swarm.Address, error) {
+	unavailable := ps.unavailablePeers(addr)
+	ps.metrics.TotalPeersSkipped.Add(float64(len(unavailable)))
+	skipPeers := append(append([]swarm.Address(nil), skip...), unavailable...)
+
+	for i := maxAttempts; i > 0; i-- {
+		peer, err := ps.nextPeer(addr, skipPeers, i == maxAttempts)
+		if err != nil {
+			return swarm.ZeroAddress, closestPeerError(err)
+		}
+		if !ps.failedRequests.Useful(peer, addr) {
+			skipPeers = append(skipPeers, peer)
+			ps.metrics.TotalPeersSkipped.Inc()
+			ps.metrics.TotalFailedCacheHits.Inc()
+			continue
+		}
+		return peer, nil
+	}
+	return swarm.ZeroAddress, fmt.Errorf("closest peer: %w", topology.ErrNotFound)
+}
+
+// recordPushSuccess records that the peer returned a receipt for the chunk
+// with the given address.
+func (ps *PushSync) recordPushSuccess(peer, addr swarm.Address) {
+	ps.failedRequests.RecordSuccess(peer, addr)
+	if ps.breaker != nil {
+		ps.breaker.RecordSuccess(peer)
+	}
+	if ps.stickyRoutes != nil {
+		ps.stickyRoutes.Set(addr, peer)
+	}
+}
+
+// recordPushFailure records that the push of the chunk with the given
+// address to the peer was attempted and failed.
+func (ps *PushSync) recordPushFailure(peer, addr swarm.Address) {
+	ps.failedRequests.RecordFailure(peer, addr)
+	if ps.breaker != nil {
+		ps.breaker.RecordFailure(peer, ps.clock.Now())
+	}
+	if ps.recentFailures != nil {
+		ps.recentFailures.Add(addr, peer, ps.clock.Now())
+	}
+	if ps.stickyRoutes != nil {
+		ps.stickyRoutes.Remove(addr, peer)
+	}
+	ps.metrics.TotalFailedSendAttempts.Inc()
+}
+
+// nextPeer returns the next peer to push the chunk with the given address
+// to, ignoring the peers in skip. With sticky routing, the first selection
+// returns the sticky peer of the chunk if it is still connected.
+func (ps *PushSync) nextPeer(addr swarm.Address, skip []swarm.Address, first bool) (swarm.Address, error) {
+	if first && ps.stickyRoutes != nil {
+		if peer, ok := ps.stickyRoutes.Get(addr); ok && !containsAddress(skip, peer) && ps.isConnected(peer) {
+			ps.metrics.TotalStickyRouteHits.Inc()
+			return peer, nil
 		}
 	}
+	return ps.peerSelector.Next(addr, skip)
+}
+
+// isConnected reports whether the peer is known to the topology.
+func (ps *PushSync) isConnected(peer swarm.Address) bool {
+	var found bool
+	_ = ps.topologyDriver.EachPeer(func(p swarm.Address, _ uint8) (bool, bool, error) {
+		found = p.Equal(peer)
+		return found, false, nil
+	})
+	return found
+}
 
-	return nil, ErrNoPush
+func containsAddress(addrs []swarm.Address, addr swarm.Address) bool {
+	for _, a := range addrs {
+		if a.Equal(addr) {
+			return true
+		}
+	}
+	return false
 }
 
-func (ps *PushSync) pushPeer(ctx context.Context, peer swarm.Address, ch swarm.Chunk) (*pb.Receipt, bool, error) {
+// contextError returns the error of a push that was stopped by its context,
+// counting it as a timeout or a cancellation. Pushes stopped because
+// PushSync was closed return ErrClosed.
+func (ps *PushSync) contextError(err error) error {
+	if ps.isClosed() {
+		return ErrClosed
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		ps.metrics.TotalPushTimeout.Inc()
+		return &pushContextError{sentinel: ErrPushTimeout, err: err}
+	case errors.Is(err, context.Canceled):
+		ps.metrics.TotalPushCanceled.Inc()
+		return &pushContextError{sentinel: ErrPushCanceled, err: err}
+	}
+	return err
+}
+
+// callReceiptHook calls the receipt hook, if it is set, without waiting for
+// it to return.
+func (ps *PushSync) callReceiptHook(chunk, peer swarm.Address, r *Receipt) {
+	if ps.receiptHook == nil {
+		return
+	}
+	r = r.clone()
+	ps.wg.Add(1)
+	go func() {
+		defer ps.wg.Done()
+		ps.receiptHook(chunk, peer, r)
+	}()
+}
+
+// observeDelivery calls the delivery observer, if it is set, with a copy of
+// the delivery to the peer.
+func (ps *PushSync) observeDelivery(peer swarm.Address, d *pb.Delivery) {
+	if ps.deliveryObserver == nil {
+		return
+	}
+	ps.deliveryObserver(peer, &pb.Delivery{
+		Address: append([]byte(nil), d.Address...),
+		Data:    append([]byte(nil), d.Data...),
+		Stamp:   append([]byte(nil), d.Stamp...),
+	})
+}
+
+// newStreamError returns the error for a stream to the peer that could not
+// be opened. Peers that are not connected anymore are told apart from peers
+// that could not be reached and, if enabled with WithDisconnectStalePeers,
+// disconnected, so that they are also removed from the topology.
+func (ps *PushSync) newStreamError(peer swarm.Address, err error) error {
+	if !errors.Is(err, p2p.ErrPeerNotFound) {
+		return fmt.Errorf("new stream for peer %s: %w", peer, err)
+	}
+
+	ps.metrics.TotalPeerDisconnected.Inc()
+	if ps.disconnectStalePeers {
+		if err := ps.streamer.Disconnect(peer); err != nil && !errors.Is(err, p2p.ErrPeerNotFound) {
+			ps.logger.Debugf("pushsync: disconnect peer %s: %v", peer, err)
+		}
+	}
+	return fmt.Errorf("new stream for disconnected peer %s: %w", peer, err)
+}
+
+// reserve reserves the price of a receipt from the peer, recording the time
+// spent waiting for the accounting.
+func (ps *PushSync) reserve(ctx context.Context, peer swarm.Address, price uint64) error {
+	start := ps.clock.Now()
+	err := ps.accounting.Reserve(ctx, peer, price)
+	ps.metrics.ReserveWaitDuration.Observe(ps.clock.Now().Sub(start).Seconds())
+	if err != nil {
+		ps.metrics.TotalReserveFailures.Inc()
+		return fmt.Errorf("reserve balance for peer %s: %w", peer, err)
+	}
+	return nil
+}
+
+// pushPeer pushes the chunk to the peer and returns its receipt. It also
+// reports whether the push was attempted, which is not the case if it failed
+// before the chunk could be sent.
+func (ps *PushSync) pushPeer(ctx context.Context, peer swarm.Address, ch swarm.Chunk) (*Receipt, bool, error) {
 	// compute the price we pay for this receipt and reserve it for the rest of this function
-	receiptPrice := ps.pricer.PeerPrice(peer, ch.Address())
+	receiptPrice := ps.peerPrice(peer, ch.Address())
 
 	// Reserve to see whether we can make the request
-	err := ps.accounting.Reserve(ctx, peer, receiptPrice)
-	if err != nil {
-		return nil, false, fmt.Errorf("reserve balance for peer %s: %w", peer, err)
+	if err := ps.reserve(ctx, peer, receiptPrice); err != nil {
+		return nil, false, err
 	}
 	defer ps.accounting.Release(peer, receiptPrice)
 
@@ -427,54 +1922,461 @@ func (ps *PushSync) pushPeer(ctx context.Context, peer swarm.Address, ch swarm.C
 		return nil, false, err
 	}
 
-	streamer, err := ps.streamer.NewStream(ctx, peer, nil, protocolName, protocolVersion, streamName)
+	s, done, err := ps.pushStream(ctx, peer)
 	if err != nil {
-		return nil, true, fmt.Errorf("new stream for peer %s: %w", peer, err)
+		// a push that timed out waiting for its turn on a batch stream did
+		// not reach the peer
+		return nil, !errors.Is(err, errBatchStreamBusy), err
 	}
-	defer streamer.Close()
 
-	w, r := protobuf.NewWriterAndReader(streamer)
-	if err := w.WriteMsgWithContext(ctx, &pb.Delivery{
+	if peerStorageFull(s.stream.Headers()) {
+		// the peer rejects the delivery, so the push is not counted as an
+		// attempt and another peer is tried instead
+		err := fmt.Errorf("peer %s: %w", peer, ErrStorageFull)
+		done(err)
+		return nil, false, err
+	}
+
+	// batch streams are shared, so only the bytes of this delivery are counted
+	bytesOut, bytesIn := s.counters.BytesOut(), s.counters.BytesIn()
+	r, inclusionProof, err := ps.deliver(ctx, s.w, s.r, s.ack, s.custody, s.proof, peer, ch, stamp)
+	ps.metrics.TotalSentBytes.Add(float64(s.counters.BytesOut() - bytesOut))
+	ps.metrics.TotalReceivedBytes.Add(float64(s.counters.BytesIn() - bytesIn))
+	if err != nil {
+		done(err)
+		return nil, true, err
+	}
+
+	err = ps.accounting.Credit(peer, receiptPrice)
+	if err != nil {
+		done(nil)
+		return nil, true, err
+	}
+
+	if !s.batch {
+		// the peer does not send anything after the receipt
+		ps.checkTrailingData(peer, s.r)
+	}
+	done(nil)
+
+	receipt := newReceipt(r, peer, ch.Address(), receiptPrice)
+	receipt.Custody = s.custody
+	receipt.InclusionProof = inclusionProof
+	return receipt, true, nil
+}
+
+// pushStream is a stream that chunks are delivered to a peer on, with the
+// options of the deliveries that were negotiated with the peer.
+type pushStream struct {
+	stream   p2p.Stream
+	w        protobuf.Writer
+	r        protobuf.Reader
+	counters *protobuf.Counters
+	ack      bool // the peer acknowledges deliveries before the receipt
+	custody  bool // receipts sign the custody digest of the chunk
+	proof    bool // receipts carry an inclusion proof
+	batch    bool // the stream is shared by the pushes of PushChunksToClosest
+}
+
+// pushStream returns the stream to deliver a chunk to the peer on, together
+// with the function that has to be called with the error of the delivery,
+// if any, once it is done. The pushes of PushChunksToClosest share a batch
+// stream to the peer, and other pushes open a new stream.
+func (ps *PushSync) pushStream(ctx context.Context, peer swarm.Address) (*pushStream, func(error), error) {
+	if streams, ok := ctx.Value(batchStreamsKey{}).(*batchStreams); ok {
+		s, done, ok, err := streams.acquire(ctx, peer, func() (*pushStream, error) {
+			return ps.newPushStream(ctx, peer, batchStreamName)
+		})
+		if ok || err != nil {
+			return s, done, err
+		}
+		// the peer does not accept batch streams
+	}
+
+	s, err := ps.newPushStream(ctx, peer, streamName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, func(err error) {
+		if err != nil {
+			_ = s.stream.Reset()
+			return
+		}
+		_ = s.stream.Close()
+	}, nil
+}
+
+// newPushStream opens a new stream with the given name to the peer, with the
+// headers and the protocol version of the pushes made within ctx.
+func (ps *PushSync) newPushStream(ctx context.Context, peer swarm.Address, name string) (*pushStream, error) {
+	version := protocolVersion
+	if ps.requestReceiptV2(ctx) {
+		version = receiptV2ProtocolVersion
+	}
+	headers := ps.makePushHeaders(ctx)
+	if ps.deliveryAck {
+		headers[ackHeader] = []byte{1}
+	}
+	if ps.requestCustody(ctx) {
+		headers[custodyHeader] = []byte{1}
+	}
+	if ps.requestInclusionProof(ctx) {
+		headers[inclusionProofHeader] = []byte{1}
+	}
+	ps.setSenderDepthHeader(headers)
+	streamer, err := ps.streamer.NewStream(ctx, peer, headers, protocolName, version, name)
+	var incompatibleErr *p2p.IncompatibleStreamError
+	if version != protocolVersion && errors.As(err, &incompatibleErr) {
+		// the peer does not support receipts with a nonce
+		version = protocolVersion
+		streamer, err = ps.streamer.NewStream(ctx, peer, headers, protocolName, version, name)
+	}
+	if err != nil {
+		return nil, ps.newStreamError(peer, err)
+	}
+
+	w, r, counters := protobuf.NewCountingWriterAndReader(streamer)
+	return &pushStream{
+		stream:   streamer,
+		w:        w,
+		r:        r,
+		counters: counters,
+		ack:      ps.deliveryAck && wantsAck(streamer.Headers()),
+		custody:  ps.requestCustody(ctx) && hasCustodyHeader(streamer.Headers()),
+		proof:    ps.requestInclusionProof(ctx) && hasInclusionProofHeader(streamer.Headers()),
+		batch:    name == batchStreamName,
+	}, nil
+}
+
+// checkTrailingData logs and counts the data that the peer sent after the
+// receipt, which violates the protocol. It waits for the data or for the peer
+// to close the stream for at most trailingDataTimeout, and reads no more than
+// a single message.
+func (ps *PushSync) checkTrailingData(peer swarm.Address, r protobuf.Reader) {
+	err := r.ReadMsgWithTimeout(trailingDataTimeout, new(pb.Receipt))
+	if errors.Is(err, io.EOF) || errors.Is(err, protobuf.ErrTimeout) {
+		return
+	}
+	ps.metrics.TotalTrailingData.Inc()
+	if err != nil {
+		ps.logger.Debugf("pushsync: peer %s sent data after the receipt: %v", peer, err)
+		return
+	}
+	ps.logger.Debugf("pushsync: peer %s sent a message after the receipt", peer)
+}
+
+// deliver writes the chunk delivery to the peer and waits for a valid receipt.
+// If ack is true, the peer acknowledges the delivery
+// before the receipt, and the returned errors match either ErrNotDelivered or
+// ErrDeliveredNoReceipt. If custody is true, the receipt signs the
+// CustodyDigest of the chunk instead of its address. If proof is true, the
+// receipt is read with the inclusion proof, which is verified and returned if
+// the peer included one.
+func (ps *PushSync) deliver(ctx context.Context, w protobuf.Writer, r protobuf.Reader, ack, custody, proof bool, peer swarm.Address, ch swarm.Chunk, stamp []byte) (receipt *pb.ReceiptBundle, inclusionProof *InclusionProof, err error) {
+	var acked bool
+	if ack {
+		defer func() {
+			if err != nil {
+				err = &deliveryError{err: err, acked: acked}
+			}
+		}()
+	}
+
+	delivery := &pb.Delivery{
 		Address: ch.Address().Bytes(),
 		Data:    ch.Data(),
 		Stamp:   stamp,
-	}); err != nil {
-		_ = streamer.Reset()
-		return nil, true, fmt.Errorf("chunk %s deliver to peer %s: %w", ch.Address(), peer, err)
 	}
+	ps.observeDelivery(peer, delivery)
 
-	ps.metrics.TotalSent.Inc()
+	// the first response of the peer is the ack, if it was requested, and
+	// the receipt otherwise
+	var (
+		a         pb.Ack
+		receiptIn = newReceiptMessage(proof)
+		in        = receiptIn
+		response  = "receipt"
+	)
+	if ack {
+		in, response = &a, "ack"
+	}
 
-	// if you manage to get a tag, just increment the respective counter
-	t, err := ps.tagger.Get(ch.TagID())
-	if err == nil && t != nil {
-		err = t.Inc(tags.StateSent)
-		if err != nil {
-			return nil, true, fmt.Errorf("tag %d increment: %v", ch.TagID(), err)
-		}
+	start := ps.clock.Now()
+	exchangeErr := protobuf.Exchange(ctx, w, r, delivery, in)
+	var e *protobuf.ExchangeError
+	if errors.As(exchangeErr, &e) && !e.Written {
+		return nil, nil, &streamFailure{err: fmt.Errorf("chunk %s deliver to peer %s: %w", ch.Address(), peer, exchangeErr)}
 	}
 
-	var receipt pb.Receipt
-	if err := r.ReadMsgWithContext(ctx, &receipt); err != nil {
-		_ = streamer.Reset()
-		return nil, true, fmt.Errorf("chunk %s receive receipt from peer %s: %w", ch.Address(), peer, err)
+	// the chunk is sent even if no response is read
+	ps.recorder.IncSent()
+
+	if err := ps.incSentTag(ctx, ch); err != nil {
+		return nil, nil, err
 	}
 
+	if exchangeErr != nil {
+		return nil, nil, &streamFailure{err: fmt.Errorf("chunk %s receive %s from peer %s: %w", ch.Address(), response, peer, exchangeErr)}
+	}
+
+	if ack {
+		if !ch.Address().Equal(swarm.NewAddress(a.Address)) {
+			return nil, nil, fmt.Errorf("invalid ack. chunk %s, peer %s", ch.Address(), peer)
+		}
+		acked = true
+
+		if err := r.ReadMsgWithContext(ctx, receiptIn); err != nil {
+			return nil, nil, &streamFailure{err: fmt.Errorf("chunk %s receive receipt from peer %s: %w", ch.Address(), peer, err)}
+		}
+	}
+
+	receipt, inclusionProof = receiptFromMessage(receiptIn)
+
 	if !ch.Address().Equal(swarm.NewAddress(receipt.Address)) {
 		// if the receipt is invalid, try to push to the next peer
-		return nil, true, fmt.Errorf("invalid receipt. chunk %s, peer %s", ch.Address(), peer)
+		return nil, nil, fmt.Errorf("invalid receipt. chunk %s, peer %s", ch.Address(), peer)
 	}
 
-	err = ps.accounting.Credit(peer, receiptPrice)
+	if inclusionProof != nil {
+		if err := inclusionProof.Verify(ch.Address()); err != nil {
+			return nil, nil, fmt.Errorf("receipt for chunk %s from peer %s: %w", ch.Address(), peer, err)
+		}
+	}
+
+	digest, err := receiptDigest(ch, custody)
 	if err != nil {
-		return nil, true, err
+		return nil, nil, fmt.Errorf("receipt digest: %w", err)
+	}
+	if digest, err = signedDigest(digest, receipt.Nonce); err != nil {
+		return nil, nil, fmt.Errorf("receipt digest: %w", err)
+	}
+
+	if ps.verifyReceipts {
+		if err := ps.verifyReceiptSignature(peer, ch.Address(), digest, receipt.Signature); err != nil {
+			ps.metrics.TotalInvalidReceiptSignature.Inc()
+			return nil, nil, fmt.Errorf("invalid receipt signature. chunk %s, peer %s: %w", ch.Address(), peer, err)
+		}
+	}
+
+	if ps.requireNeighborhood {
+		if err := ps.verifyReceiptDepth(ch.Address(), digest, receipt.Signature); err != nil {
+			ps.metrics.TotalReceiptsOutsideDepth.Inc()
+			return nil, nil, fmt.Errorf("receipt for chunk %s from peer %s: %w", ch.Address(), peer, err)
+		}
+	}
+
+	ps.recorder.ObserveRTT(ps.clock.Now().Sub(start))
+
+	return receipt, inclusionProof, nil
+}
+
+// newReceipt creates a Receipt for the chunk from the receipt returned by peer
+// for the given price.
+func newReceipt(r *pb.ReceiptBundle, peer, chunk swarm.Address, price uint64) *Receipt {
+	return &Receipt{
+		Address:           swarm.NewAddress(r.Address),
+		Signature:         r.Signature,
+		Peer:              peer,
+		Proximity:         swarm.Proximity(peer.Bytes(), chunk.Bytes()),
+		Price:             price,
+		Nonce:             r.Nonce,
+		ReplicaSignatures: r.ReplicaSignatures,
+		MissingReplicas:   int(r.MissingReplicas),
+	}
+}
+
+// clone returns a deep copy of the receipt.
+func (r *Receipt) clone() *Receipt {
+	c := *r
+	c.Address = swarm.NewAddress(append([]byte(nil), r.Address.Bytes()...))
+	c.Signature = append([]byte(nil), r.Signature...)
+	c.Peer = swarm.NewAddress(append([]byte(nil), r.Peer.Bytes()...))
+	if r.Nonce != nil {
+		c.Nonce = append([]byte(nil), r.Nonce...)
+	}
+	if r.ReplicaSignatures != nil {
+		c.ReplicaSignatures = make([][]byte, len(r.ReplicaSignatures))
+		for i, sig := range r.ReplicaSignatures {
+			c.ReplicaSignatures[i] = append([]byte(nil), sig...)
+		}
+	}
+	if r.InclusionProof != nil {
+		c.InclusionProof = r.InclusionProof.clone()
+	}
+	return &c
+}
+
+// ValidateReceipt recovers the overlay address of the node that signed the
+// receipt on the network with the given id. It returns an error if the
+// signature is malformed. Receipts with proof of custody sign the
+// CustodyDigest of the chunk, which requires the chunk data, and are
+// validated with ValidateCustodyReceipt instead. The nonce of the receipt, if
+// it has one, is validated as well. It takes the network id in addition to
+// the receipt, as the overlay address of the signer is derived from it.
+func ValidateReceipt(r *Receipt, networkID uint64) (swarm.Address, error) {
+	if r.Custody {
+		return swarm.ZeroAddress, errors.New("receipt with proof of custody")
+	}
+	digest, err := signedDigest(ReceiptPayload(r.Address), r.Nonce)
+	if err != nil {
+		return swarm.ZeroAddress, fmt.Errorf("receipt digest: %w", err)
+	}
+	return recoverSigner(digest, r.Signature, networkID)
+}
+
+// ValidateCustodyReceipt recovers the overlay address of the node that
+// signed the receipt with proof of custody for the chunk on the network with
+// the given id.
+func ValidateCustodyReceipt(r *Receipt, ch swarm.Chunk, networkID uint64) (swarm.Address, error) {
+	if !r.Address.Equal(ch.Address()) {
+		return swarm.ZeroAddress, fmt.Errorf("receipt address %s does not match chunk %s", r.Address, ch.Address())
+	}
+	digest, err := CustodyDigest(ch)
+	if err != nil {
+		return swarm.ZeroAddress, fmt.Errorf("custody digest: %w", err)
+	}
+	if digest, err = signedDigest(digest, r.Nonce); err != nil {
+		return swarm.ZeroAddress, fmt.Errorf("receipt digest: %w", err)
+	}
+	return recoverSigner(digest, r.Signature, networkID)
+}
+
+// recoverSigner recovers the overlay address of the node that signed the
+// digest on the network with the given id.
+func recoverSigner(digest, signature []byte, networkID uint64) (swarm.Address, error) {
+	pubKey, err := crypto.Recover(signature, digest)
+	if err != nil {
+		return swarm.ZeroAddress, fmt.Errorf("recover signer: %w", err)
+	}
+
+	signer, err := crypto.NewOverlayAddress(*pubKey, networkID)
+	if err != nil {
+		return swarm.ZeroAddress, fmt.Errorf("signer overlay: %w", err)
+	}
+
+	return signer, nil
+}
+
+// peerPrice returns the price the peer charges for the chunk, from the price
+// cache if it is enabled.
+func (ps *PushSync) peerPrice(peer, chunk swarm.Address) uint64 {
+	if ps.priceCache == nil {
+		return ps.pricer.PeerPrice(peer, chunk)
+	}
+
+	po := swarm.Proximity(peer.Bytes(), chunk.Bytes())
+	if price, ok := ps.priceCache.Get(peer, po, ps.clock.Now()); ok {
+		return price
+	}
+	price := ps.pricer.PeerPrice(peer, chunk)
+	ps.priceCache.Set(peer, po, price, ps.clock.Now())
+	return price
+}
+
+// NotifyPeerPrice drops the cached prices of the peer, so that the next push
+// to it gets its price from the pricer. It should be called whenever the
+// price of the peer changes, and it is called by the pricing protocol on
+// every pricing announcement of the peer.
+func (ps *PushSync) NotifyPeerPrice(peer swarm.Address) {
+	if ps.priceCache != nil {
+		ps.priceCache.Invalidate(peer)
+	}
+}
+
+// verifyReceiptSignature recovers the signer of a receipt and checks that it
+// is at least as close to the chunk as the peer that returned the receipt, as
+// the storer is always found further down the forwarding path.
+func (ps *PushSync) verifyReceiptSignature(peer, chunk swarm.Address, digest, signature []byte) error {
+	signer, err := recoverSigner(digest, signature, ps.networkID)
+	if err != nil {
+		return err
+	}
+
+	if dcmp, _ := swarm.DistanceCmp(chunk.Bytes(), signer.Bytes(), peer.Bytes()); dcmp == -1 {
+		return fmt.Errorf("signer %s farther from chunk than peer", signer)
+	}
+
+	return nil
+}
+
+// verifyReceiptDepth recovers the signer of a receipt and checks that it is
+// within the neighborhood depth of the chunk.
+func (ps *PushSync) verifyReceiptDepth(chunk swarm.Address, digest, signature []byte) error {
+	signer, err := recoverSigner(digest, signature, ps.networkID)
+	if err != nil {
+		return err
+	}
+
+	depth := ps.topologyDriver.NeighborhoodDepth()
+	if po := swarm.Proximity(signer.Bytes(), chunk.Bytes()); po < depth {
+		return fmt.Errorf("signer %s proximity %d, depth %d: %w", signer, po, depth, ErrReceiptOutsideDepth)
+	}
+
+	return nil
+}
+
+// Close stops accepting new pushes and waits for the running replications
+// to finish. It is safe to call Close more than once.
+func (ps *PushSync) Close() error {
+	ps.closeOnce.Do(func() {
+		ps.logger.Info("pushsync shutting down")
+		if ps.replicationBatcher != nil {
+			ps.replicationBatcher.close()
+		}
+		close(ps.quit)
+	})
+	cc := make(chan struct{})
+	go func() {
+		defer close(cc)
+		ps.wg.Wait()
+	}()
+
+	select {
+	case <-cc:
+	case <-ps.clock.After(10 * time.Second):
+		ps.logger.Warning("pushsync shutting down with running goroutines")
+	}
+	return nil
+}
+
+func (ps *PushSync) isClosed() bool {
+	select {
+	case <-ps.quit:
+		return true
+	default:
+		return false
 	}
+}
+
+// withQuit returns a context that is also cancelled when PushSync is closed.
+func (ps *PushSync) withQuit(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-ps.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
 
-	return &receipt, true, nil
+// detachedContext is a context that carries the values of its parent, but
+// is never cancelled and has no deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
 }
 
 type pushResult struct {
-	receipt   *pb.Receipt
+	receipt   *Receipt
 	err       error
 	attempted bool
 }
@@ -524,3 +2426,331 @@ func (f *failedRequestCache) Useful(peer swarm.Address, chunk swarm.Address) boo
 	}
 	return val.(int) < failureThreshold
 }
+
+// peerPriceCache keeps the prices of peers for a proximity order for a
+// limited time.
+type peerPriceCache struct {
+	mtx   sync.Mutex
+	ttl   time.Duration
+	peers map[string]map[uint8]peerPriceEntry
+}
+
+type peerPriceEntry struct {
+	price   uint64
+	expires time.Time
+}
+
+func newPeerPriceCache(ttl time.Duration) *peerPriceCache {
+	return &peerPriceCache{
+		ttl:   ttl,
+		peers: make(map[string]map[uint8]peerPriceEntry),
+	}
+}
+
+// Get returns the price of the peer for the proximity order if it has not
+// expired at the time now.
+func (c *peerPriceCache) Get(peer swarm.Address, po uint8, now time.Time) (uint64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.peers[peer.ByteString()][po]
+	if !ok || now.After(e.expires) {
+		return 0, false
+	}
+	return e.price, true
+}
+
+// Set keeps the price of the peer for the proximity order, computed at the
+// time now.
+func (c *peerPriceCache) Set(peer swarm.Address, po uint8, price uint64, now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	prices, ok := c.peers[peer.ByteString()]
+	if !ok {
+		prices = make(map[uint8]peerPriceEntry)
+		c.peers[peer.ByteString()] = prices
+	}
+	prices[po] = peerPriceEntry{price: price, expires: now.Add(c.ttl)}
+}
+
+func (c *peerPriceCache) Invalidate(peer swarm.Address) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.peers, peer.ByteString())
+}
+
+// recentFailures keeps the peers that recently failed to push a chunk for a
+// limited time.
+type recentFailures struct {
+	mtx    sync.Mutex
+	ttl    time.Duration
+	chunks map[string]map[string]time.Time // chunk -> peer -> expiry
+}
+
+func newRecentFailures(ttl time.Duration) *recentFailures {
+	return &recentFailures{
+		ttl:    ttl,
+		chunks: make(map[string]map[string]time.Time),
+	}
+}
+
+// Add records the failure of the peer to push the chunk at the time now.
+// Expired failures of all chunks are dropped.
+func (f *recentFailures) Add(chunk, peer swarm.Address, now time.Time) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for key, peers := range f.chunks {
+		for p, expires := range peers {
+			if !now.Before(expires) {
+				delete(peers, p)
+			}
+		}
+		if len(peers) == 0 {
+			delete(f.chunks, key)
+		}
+	}
+
+	peers, ok := f.chunks[chunk.ByteString()]
+	if !ok {
+		peers = make(map[string]time.Time)
+		f.chunks[chunk.ByteString()] = peers
+	}
+	peers[peer.ByteString()] = now.Add(f.ttl)
+}
+
+// Peers returns the peers that failed to push the chunk and have not expired
+// at the time now.
+func (f *recentFailures) Peers(chunk swarm.Address, now time.Time) (peers []swarm.Address) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for p, expires := range f.chunks[chunk.ByteString()] {
+		if now.Before(expires) {
+			peers = append(peers, swarm.NewAddress([]byte(p)))
+		}
+	}
+	return peers
+}
+
+// pushCancels keeps the cancel functions of the pushes in flight by the
+// address of their chunk.
+type pushCancels struct {
+	mtx    sync.Mutex
+	nextID uint64
+	chunks map[string]map[uint64]context.CancelFunc
+}
+
+func newPushCancels() *pushCancels {
+	return &pushCancels{chunks: make(map[string]map[uint64]context.CancelFunc)}
+}
+
+// Add registers the cancel function of a push of the chunk. The returned id
+// removes it with Remove once the push is done.
+func (c *pushCancels) Add(chunk swarm.Address, cancel context.CancelFunc) (id uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	key := chunk.ByteString()
+	cancels, ok := c.chunks[key]
+	if !ok {
+		cancels = make(map[uint64]context.CancelFunc)
+		c.chunks[key] = cancels
+	}
+	id = c.nextID
+	c.nextID++
+	cancels[id] = cancel
+	return id
+}
+
+// Remove removes the cancel function of a push of the chunk registered with
+// Add.
+func (c *pushCancels) Remove(chunk swarm.Address, id uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	key := chunk.ByteString()
+	cancels := c.chunks[key]
+	delete(cancels, id)
+	if len(cancels) == 0 {
+		delete(c.chunks, key)
+	}
+}
+
+// Cancel calls the cancel functions of all pushes of the chunk.
+func (c *pushCancels) Cancel(chunk swarm.Address) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, cancel := range c.chunks[chunk.ByteString()] {
+		cancel()
+	}
+}
+
+// stickyRoutes keeps the last peer that returned a valid receipt for the
+// chunks in each bucket, where the bucket of a chunk is the first byte of its
+// address.
+type stickyRoutes struct {
+	mtx   sync.Mutex
+	peers [256]swarm.Address
+}
+
+// Get returns the sticky peer of the bucket of the chunk, if there is one.
+func (r *stickyRoutes) Get(chunk swarm.Address) (swarm.Address, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	peer := r.peers[chunk.Bytes()[0]]
+	return peer, !peer.IsZero()
+}
+
+// Set makes the peer the sticky peer of the bucket of the chunk.
+func (r *stickyRoutes) Set(chunk, peer swarm.Address) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.peers[chunk.Bytes()[0]] = peer
+}
+
+// Remove forgets the sticky peer of the bucket of the chunk, if it is the
+// given peer.
+func (r *stickyRoutes) Remove(chunk, peer swarm.Address) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.peers[chunk.Bytes()[0]].Equal(peer) {
+		r.peers[chunk.Bytes()[0]] = swarm.ZeroAddress
+	}
+}
+
+// receiptCache keeps the receipts of recently pushed chunks for a limited
+// time.
+type receiptCache struct {
+	ttl   time.Duration
+	cache *lru.Cache
+}
+
+type receiptCacheEntry struct {
+	receipt *Receipt
+	expires time.Time
+}
+
+func newReceiptCache(size int, ttl time.Duration) *receiptCache {
+	// not necessary to check error here as size is always positive
+	cache, _ := lru.New(size)
+	return &receiptCache{ttl: ttl, cache: cache}
+}
+
+// Get returns a copy of the receipt of the chunk if it has not expired at the
+// time now.
+func (c *receiptCache) Get(chunk swarm.Address, now time.Time) (*Receipt, bool) {
+	v, ok := c.cache.Get(chunk.ByteString())
+	if !ok {
+		return nil, false
+	}
+	e := v.(receiptCacheEntry)
+	if now.After(e.expires) {
+		c.cache.Remove(chunk.ByteString())
+		return nil, false
+	}
+	return e.receipt.clone(), true
+}
+
+// Add keeps a copy of the receipt of the chunk, received at the time now.
+func (c *receiptCache) Add(chunk swarm.Address, r *Receipt, now time.Time) {
+	c.cache.Add(chunk.ByteString(), receiptCacheEntry{receipt: r.clone(), expires: now.Add(c.ttl)})
+}
+
+// closestPeerSelector selects the peer closest to the chunk address.
+type closestPeerSelector struct {
+	topology    topology.ClosestPeerer
+	includeSelf bool
+}
+
+func (s closestPeerSelector) Next(addr swarm.Address, skip []swarm.Address) (swarm.Address, error) {
+	return s.topology.ClosestPeer(addr, s.includeSelf, skip...)
+}
+
+// cacOrSOCValidator accepts content addressed chunks and single owner
+// chunks, counting the invalid single owner chunks.
+type cacOrSOCValidator struct {
+	invalidSOC prometheus.Counter
+}
+
+func (v cacOrSOCValidator) Validate(ch swarm.Chunk) error {
+	if cac.Valid(ch) {
+		return nil
+	}
+	if _, err := validateSOC(ch); err != nil {
+		v.invalidSOC.Inc()
+		return err
+	}
+	return nil
+}
+
+// peerCircuitBreaker excludes peers from selection for a cooldown period
+// after too many consecutive failed pushes.
+type peerCircuitBreaker struct {
+	mtx         sync.Mutex
+	maxFailures int
+	cooldown    time.Duration
+	peers       map[string]*peerBreakerState
+}
+
+type peerBreakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+func newPeerCircuitBreaker(maxFailures int, cooldown time.Duration) *peerCircuitBreaker {
+	return &peerCircuitBreaker{
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+		peers:       make(map[string]*peerBreakerState),
+	}
+}
+
+// RecordFailure records a failed push to the peer at the time now, opening
+// the breaker for the peer after too many consecutive failures.
+func (b *peerCircuitBreaker) RecordFailure(peer swarm.Address, now time.Time) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	st, ok := b.peers[peer.ByteString()]
+	if !ok {
+		st = new(peerBreakerState)
+		b.peers[peer.ByteString()] = st
+	}
+	st.failures++
+	if st.failures >= b.maxFailures {
+		st.failures = 0
+		st.openUntil = now.Add(b.cooldown)
+	}
+}
+
+func (b *peerCircuitBreaker) RecordSuccess(peer swarm.Address) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.peers, peer.ByteString())
+}
+
+// OpenPeers returns the peers that are excluded from selection at the time
+// now.
+func (b *peerCircuitBreaker) OpenPeers(now time.Time) (peers []swarm.Address) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for key, st := range b.peers {
+		if st.openUntil.IsZero() {
+			continue
+		}
+		if now.Before(st.openUntil) {
+			peers = append(peers, swarm.NewAddress([]byte(key)))
+			continue
+		}
+		// the cooldown has passed, give the peer another chance
+		delete(b.peers, key)
+	}
+	return peers
+}
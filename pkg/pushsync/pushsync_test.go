@@ -7,9 +7,13 @@ package pushsync_test
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"io/ioutil"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,9 +26,11 @@ import (
 	"github.com/ethersphere/bee/pkg/p2p/protobuf"
 	"github.com/ethersphere/bee/pkg/p2p/streamtest"
 	"github.com/ethersphere/bee/pkg/postage"
+	postagetesting "github.com/ethersphere/bee/pkg/postage/testing"
 	pricermock "github.com/ethersphere/bee/pkg/pricer/mock"
 	"github.com/ethersphere/bee/pkg/pushsync"
 	"github.com/ethersphere/bee/pkg/pushsync/pb"
+	"github.com/ethersphere/bee/pkg/soc"
 	statestore "github.com/ethersphere/bee/pkg/statestore/mock"
 	"github.com/ethersphere/bee/pkg/storage"
 	mocks "github.com/ethersphere/bee/pkg/storage/mock"
@@ -33,6 +39,9 @@ import (
 	"github.com/ethersphere/bee/pkg/tags"
 	"github.com/ethersphere/bee/pkg/topology"
 	"github.com/ethersphere/bee/pkg/topology/mock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -84,11 +93,31 @@ func TestPushClosest(t *testing.T) {
 		t.Fatal("invalid receipt")
 	}
 
+	if !closestPeer.Equal(receipt.Peer) {
+		t.Fatalf("got receipt peer %s, want %s", receipt.Peer, closestPeer)
+	}
+
+	if po := swarm.Proximity(closestPeer.Bytes(), chunk.Address().Bytes()); receipt.Proximity != po {
+		t.Fatalf("got receipt proximity %d, want %d", receipt.Proximity, po)
+	}
+
+	if receipt.Price != fixedPrice {
+		t.Fatalf("got receipt price %d, want %d", receipt.Price, fixedPrice)
+	}
+
 	// this intercepts the outgoing delivery message
 	waitOnRecordAndTest(t, closestPeer, recorder, chunk.Address(), chunk.Data())
 
 	// this intercepts the incoming receipt message
 	waitOnRecordAndTest(t, closestPeer, recorder, chunk.Address(), nil)
+
+	if got := psPivot.Stats().Sent; got != 1 {
+		t.Fatalf("got %d sent chunks on pivot, want 1", got)
+	}
+	if got := psPeer.Stats().Received; got != 1 {
+		t.Fatalf("got %d received chunks on peer, want 1", got)
+	}
+
 	balance, err := pivotAccounting.Balance(closestPeer)
 	if err != nil {
 		t.Fatal(err)
@@ -309,6 +338,397 @@ func TestFailToReplicateBeforeReceipt(t *testing.T) {
 	}
 }
 
+// TestReplicationFactor checks that the storer node replicates the chunk to
+// no more neighbors than the configured replication factor.
+func TestReplicationFactor(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }))
+	defer storerSecond.Close()
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer))
+
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithReplicationFactor(0)}, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !chunk.Address().Equal(receipt.Address) {
+		t.Fatal("invalid receipt")
+	}
+
+	// no replication should happen to the second peer
+	secondRecorder.WaitRecords(t, secondPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+}
+
+// TestMaxConcurrentReplications checks that replications beyond the
+// configured limit of concurrent replications are skipped.
+func TestMaxConcurrentReplications(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+	thirdPeer := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	psNeighbor, storerNeighbor, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }))
+	defer storerNeighbor.Close()
+
+	// hold the first replication until the others are attempted
+	release := make(chan struct{})
+	blockHandler := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+		return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+			<-release
+			return h(ctx, p, s)
+		}
+	}
+	neighborRecorder := streamtest.New(streamtest.WithProtocols(psNeighbor.Protocol()), streamtest.WithBaseAddr(closestPeer), streamtest.WithMiddlewares(blockHandler))
+
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, neighborRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithMaxConcurrentReplications(1)}, mock.WithPeers(secondPeer, thirdPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	neighborRecorder.WaitRecords(t, secondPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+	neighborRecorder.WaitRecords(t, thirdPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+}
+
+// TestReplicaReceipts checks that the storer returns the signatures of the
+// replicas of the chunk when they are requested.
+func TestReplicaReceipts(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+	thirdPeer := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name         string
+		enabled      bool
+		wantReplicas int
+	}{
+		{name: "enabled", enabled: true, wantReplicas: 2},
+		{name: "disabled", enabled: false, wantReplicas: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psNeighbor, storerNeighbor, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }))
+			defer storerNeighbor.Close()
+			neighborRecorder := streamtest.New(streamtest.WithProtocols(psNeighbor.Protocol()), streamtest.WithBaseAddr(closestPeer))
+
+			psStorer, storerPeer, _ := createPushSyncNodeWithAccounting(t, closestPeer, defaultPrices, neighborRecorder, nil, defaultSigner, accountingmock.NewAccounting(), mock.WithPeers(secondPeer, thirdPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+			recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithReplicaReceipts(tc.enabled)}, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !chunk.Address().Equal(receipt.Address) {
+				t.Fatalf("got receipt address %s, want %s", receipt.Address, chunk.Address())
+			}
+			if got := len(receipt.ReplicaSignatures); got != tc.wantReplicas {
+				t.Fatalf("got %d replica signatures, want %d", got, tc.wantReplicas)
+			}
+			for _, sig := range receipt.ReplicaSignatures {
+				if len(sig) == 0 {
+					t.Fatal("got empty replica signature")
+				}
+			}
+		})
+	}
+}
+
+// TestReplicationJitter checks that replication happens when its start is
+// delayed by a random jitter.
+func TestReplicationJitter(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }))
+	defer storerSecond.Close()
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer))
+
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithReplicationJitter(100 * time.Millisecond)}, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	waitOnRecordAndTest(t, secondPeer, secondRecorder, chunk.Address(), chunk.Data())
+}
+
+// TestSynchronousReplication checks that the storer returns the receipt only
+// after the chunk was replicated to a neighbor, even if the replication is
+// delayed.
+func TestSynchronousReplication(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }))
+	defer storerSecond.Close()
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer))
+
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithSynchronousReplication(1), pushsync.WithReplicationJitter(100 * time.Millisecond)}, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// the replica stored the chunk before the receipt was returned
+	records, err := secondRecorder.Records(secondPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d replication records, want 1", len(records))
+	}
+	has, err := storerSecond.Has(context.Background(), chunk.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("chunk not stored by the replica")
+	}
+}
+
+// TestSynchronousReplicationTimeout checks that the storer returns the
+// receipt with the number of missing replicas if the minimum number of
+// replicas does not store the chunk within the neighbor push timeout.
+func TestSynchronousReplicationTimeout(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }))
+	defer storerSecond.Close()
+
+	// hold the replication until the receipt is returned
+	release := make(chan struct{})
+	blockHandler := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+		return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+			<-release
+			return h(ctx, p, s)
+		}
+	}
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer), streamtest.WithMiddlewares(blockHandler))
+
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithSynchronousReplication(1), pushsync.WithNeighborPushTimeout(100 * time.Millisecond)}, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	close(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.MissingReplicas != 1 {
+		t.Fatalf("got %d missing replicas, want 1", receipt.MissingReplicas)
+	}
+	if got := metricValue(t, psStorer, "pushsync_total_replication_wait_timeouts"); got != 1 {
+		t.Fatalf("got %v replication wait timeouts, want 1", got)
+	}
+}
+
+// TestNeighborPushTimeout checks that a replication to a neighbor that does
+// not respond fails after the timeout set with WithNeighborPushTimeout.
+func TestNeighborPushTimeout(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }))
+	defer storerSecond.Close()
+
+	// the neighbor does not handle the replication until the test is done
+	release := make(chan struct{})
+	defer close(release)
+	blockHandler := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+		return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+			<-release
+			return h(ctx, p, s)
+		}
+	}
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer), streamtest.WithMiddlewares(blockHandler))
+
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithNeighborPushTimeout(100 * time.Millisecond)}, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// sleep for less than the default timeout to let the replication fail
+	time.Sleep(time.Second)
+
+	if got := metricValue(t, psStorer, "pushsync_total_replication_error"); got != 1 {
+		t.Fatalf("got %v replication errors, want 1", got)
+	}
+}
+
+// TestReplicasStored checks that the number of replicas stored by the
+// neighbors is recorded once the replication of a chunk is done.
+func TestReplicasStored(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }))
+	defer storerSecond.Close()
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer))
+
+	psStorer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// sleep for a bit to allow the second peer to store the replicated chunk
+	time.Sleep(time.Millisecond * 500)
+
+	h := histograms(t, psStorer, "pushsync_replicas_stored")[""]
+	if h.GetSampleCount() != 1 {
+		t.Fatalf("got %d replications recorded, want 1", h.GetSampleCount())
+	}
+	if h.GetSampleSum() != 1 {
+		t.Fatalf("got %v replicas stored, want 1", h.GetSampleSum())
+	}
+}
+
+// TestReplicationBatchWindow checks that the replications of chunks to the
+// same neighbor within the batch window are delivered over a single stream.
+func TestReplicationBatchWindow(t *testing.T) {
+	// chunk data to upload
+	chunks := []swarm.Chunk{testingc.FixtureChunk("7000"), testingc.FixtureChunk("0025")}
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerSecond.Close()
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer))
+
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithReplicationBatchWindow(500 * time.Millisecond)}, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	for _, chunk := range chunks {
+		if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	secondRecorder.WaitRecords(t, secondPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.BatchStreamName, 1, 5)
+	secondRecorder.WaitRecords(t, secondPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+}
+
+// TestReplicationBatchWindowClock checks that the batch window of
+// replications passes on the clock of the node.
+func TestReplicationBatchWindowClock(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return true }), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerSecond.Close()
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer))
+
+	clock := &fakeClock{afterC: make(chan time.Time)}
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithClock(clock), pushsync.WithReplicationBatchWindow(time.Millisecond)}, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// the window is far shorter than the wait, but the clock has not passed it
+	time.Sleep(100 * time.Millisecond)
+	if records, _ := secondRecorder.Records(secondPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.BatchStreamName); len(records) != 0 {
+		t.Fatalf("got %d batch streams before the window passed, want 0", len(records))
+	}
+
+	select {
+	case clock.afterC <- time.Now():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the batch window")
+	}
+
+	secondRecorder.WaitRecords(t, secondPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.BatchStreamName, 1, 5)
+}
+
 // PushChunkToClosest tests the sending of chunk to closest peer from the origination source perspective.
 // it also checks wether the tags are incremented properly if they are present
 func TestPushChunkToClosest(t *testing.T) {
@@ -397,39 +817,279 @@ func TestPushChunkToClosest(t *testing.T) {
 	}
 }
 
-func TestPushChunkToNextClosest(t *testing.T) {
-
+// TestPushChunkToClosestAsync checks that the result of an asynchronous push
+// is received from the returned channel.
+func TestPushChunkToClosestAsync(t *testing.T) {
 	// chunk data to upload
 	chunk := testingc.FixtureChunk("7000")
 
-	// create a pivot node and a mocked closest node
-	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000") // base is 0000
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
 
-	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
-	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
 
-	// peer is the node responding to the chunk receipt message
-	// mock should return ErrWantSelf since there's no one to forward to
-	psPeer1, storerPeer1, _, peerAccounting1 := createPushSyncNode(t, peer1, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
-	defer storerPeer1.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
 
-	psPeer2, storerPeer2, _, peerAccounting2 := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
-	defer storerPeer2.Close()
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
 
-	var fail = true
-	var lock sync.Mutex
+	select {
+	case res := <-psPivot.PushChunkToClosestAsync(context.Background(), chunk):
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if !chunk.Address().Equal(res.Receipt.Address) {
+			t.Fatalf("got receipt address %s, want %s", res.Receipt.Address, chunk.Address())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("push result not received")
+	}
+}
 
-	recorder := streamtest.New(
-		streamtest.WithProtocols(
-			psPeer1.Protocol(),
-			psPeer2.Protocol(),
-		),
-		streamtest.WithMiddlewares(
-			func(h p2p.HandlerFunc) p2p.HandlerFunc {
-				return func(ctx context.Context, peer p2p.Peer, stream p2p.Stream) error {
-					// this hack is required to simulate first storer node failing
-					lock.Lock()
-					defer lock.Unlock()
+// TestStorePutQueue checks that chunks stored through the put queue are
+// recorded in the write-ahead log until they are stored.
+func TestStorePutQueue(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	wal := &memoryLog{}
+	psPeer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithStorePutQueue(4), pushsync.WithWriteAheadLog(wal)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// the queued chunks are stored on close
+	if err := psPeer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	has, err := storerPeer.Has(context.Background(), chunk.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("queued chunk not stored")
+	}
+	if appended, removed := wal.counts(); appended != 1 || removed != 1 {
+		t.Fatalf("got %d appended and %d removed chunks, want 1 and 1", appended, removed)
+	}
+}
+
+// memoryLog is a write-ahead log that counts the appended and removed
+// chunks.
+type memoryLog struct {
+	mu                sync.Mutex
+	appended, removed int
+}
+
+func (l *memoryLog) Append(swarm.Chunk) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.appended++
+	return nil
+}
+
+func (l *memoryLog) Remove(swarm.Address) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.removed++
+	return nil
+}
+
+func (l *memoryLog) Iterate(func(swarm.Chunk) (bool, error)) error {
+	return nil
+}
+
+func (l *memoryLog) counts() (appended, removed int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.appended, l.removed
+}
+
+// TestStateStoreWAL checks that the chunks left in the write-ahead log are
+// stored through the put queue.
+func TestStateStoreWAL(t *testing.T) {
+	chunk := testingc.FixtureChunk("7000")
+
+	stateStore := statestore.NewStateStore()
+	defer stateStore.Close()
+
+	wal := pushsync.NewStateStoreWAL(stateStore)
+	if err := wal.Append(chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	psPeer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithStorePutQueue(4), pushsync.WithWriteAheadLog(wal)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	// the queued chunks are stored on close
+	if err := psPeer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	has, err := storerPeer.Has(context.Background(), chunk.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("logged chunk not stored")
+	}
+
+	var logged int
+	if err := wal.Iterate(func(swarm.Chunk) (bool, error) {
+		logged++
+		return false, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if logged != 0 {
+		t.Fatalf("got %d chunks left in the log, want 0", logged)
+	}
+}
+
+// TestPreferredPeers checks that a preferred peer is selected only if it is
+// among the closest candidates for the chunk.
+func TestPreferredPeers(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("7100000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("7200000000000000000000000000000000000000000000000000000000000000")
+	thirdPeer := swarm.MustParseHexAddress("7400000000000000000000000000000000000000000000000000000000000000")
+	farPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name      string
+		preferred swarm.Address
+		want      swarm.Address
+	}{
+		{name: "candidate", preferred: thirdPeer, want: thirdPeer},
+		{name: "not a candidate", preferred: farPeer, want: closestPeer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithPreferredPeers([]swarm.Address{tc.preferred})}, mock.WithPeers(closestPeer, secondPeer, thirdPeer, farPeer))
+			defer storerPivot.Close()
+
+			peer, _, err := psPivot.ClosestPeer(context.Background(), chunk.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !peer.Equal(tc.want) {
+				t.Fatalf("got peer %s, want %s", peer, tc.want)
+			}
+		})
+	}
+}
+
+// TestSamePeerRetries checks that a push is retried to the same peer on a
+// new stream if the stream fails.
+func TestSamePeerRetries(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name    string
+		retries int
+		wantErr bool
+	}{
+		{name: "retried", retries: 1},
+		{name: "not retried", retries: 0, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			// reset the first stream of the peer
+			var streams int32
+			resetFirst := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+				return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+					if atomic.AddInt32(&streams, 1) == 1 {
+						return errors.New("stream reset")
+					}
+					return h(ctx, p, s)
+				}
+			}
+			recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithMiddlewares(resetFirst))
+
+			psPivot, storerPivot, pivotTags := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithSamePeerRetries(tc.retries)}, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			ta, err := pivotTags.Create(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk.WithTagID(ta.Uid))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !receipt.Peer.Equal(closestPeer) {
+				t.Fatalf("got receipt from peer %s, want %s", receipt.Peer, closestPeer)
+			}
+			if got := atomic.LoadInt32(&streams); got != 2 {
+				t.Fatalf("got %d streams, want 2", got)
+			}
+			// the retried delivery is counted as sent once
+			if got := ta.Get(tags.StateSent); got != 1 {
+				t.Fatalf("got %d sent chunks, want 1", got)
+			}
+		})
+	}
+}
+
+func TestPushChunkToNextClosest(t *testing.T) {
+
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	// create a pivot node and a mocked closest node
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000") // base is 0000
+
+	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	// peer is the node responding to the chunk receipt message
+	// mock should return ErrWantSelf since there's no one to forward to
+	psPeer1, storerPeer1, _, peerAccounting1 := createPushSyncNode(t, peer1, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer1.Close()
+
+	psPeer2, storerPeer2, _, peerAccounting2 := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer2.Close()
+
+	var fail = true
+	var lock sync.Mutex
+
+	recorder := streamtest.New(
+		streamtest.WithProtocols(
+			psPeer1.Protocol(),
+			psPeer2.Protocol(),
+		),
+		streamtest.WithMiddlewares(
+			func(h p2p.HandlerFunc) p2p.HandlerFunc {
+				return func(ctx context.Context, peer p2p.Peer, stream p2p.Stream) error {
+					// this hack is required to simulate first storer node failing
+					lock.Lock()
+					defer lock.Unlock()
 					if fail {
 						fail = false
 						stream.Close()
@@ -737,127 +1397,3139 @@ func TestHandler(t *testing.T) {
 	}
 }
 
-func TestSignsReceipt(t *testing.T) {
+// TestHandlerOversizedChunk checks that deliveries with chunk data larger
+// than any valid chunk are rejected.
+func TestHandlerOversizedChunk(t *testing.T) {
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
 
-	// chunk data to upload
-	chunk := testingc.FixtureChunk("7000")
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
 
-	signer := cryptomock.New(cryptomock.WithSignFunc(func([]byte) ([]byte, error) {
-		return []byte{1}, nil
-	}))
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
 
-	// create a pivot node and a mocked closest node
-	pivotPeer := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
-	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	stream, err := recorder.NewStream(context.Background(), closestPeer, nil, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
 
-	// Create the closest peer
-	psClosestPeer, closestStorerPeerDB, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, signer, mock.WithClosestPeerErr(topology.ErrWantSelf))
-	defer closestStorerPeerDB.Close()
+	w := protobuf.NewWriter(stream)
+	if err := w.WriteMsg(&pb.Delivery{
+		Address: closestPeer.Bytes(),
+		Data:    make([]byte, 2*swarm.ChunkWithSpanSize),
+	}); err != nil {
+		t.Fatal(err)
+	}
 
-	closestRecorder := streamtest.New(streamtest.WithProtocols(psClosestPeer.Protocol()), streamtest.WithBaseAddr(pivotPeer))
+	records := recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+	if !errors.Is(records[0].Err(), swarm.ErrInvalidChunk) {
+		t.Fatalf("got error %v, want %v", records[0].Err(), swarm.ErrInvalidChunk)
+	}
+}
 
-	// creating the pivot peer who will act as a forwarder node with a higher price (17)
-	psPivot, storerPivotDB, _, _ := createPushSyncNode(t, pivotPeer, defaultPrices, closestRecorder, nil, signer, mock.WithClosestPeer(closestPeer))
-	defer storerPivotDB.Close()
+// TestHandlerInvalidSOCAddress checks that single owner chunks delivered
+// with an address that is not derived from their id and owner are rejected.
+func TestHandlerInvalidSOCAddress(t *testing.T) {
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
 
-	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch, err := soc.New(make([]byte, soc.IdSize), testingc.FixtureChunk("7000")).Sign(crypto.NewDefaultSigner(key))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !chunk.Address().Equal(receipt.Address) {
-		t.Fatal("invalid receipt")
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	stream, err := recorder.NewStream(context.Background(), closestPeer, nil, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName)
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer stream.Close()
 
-	if !bytes.Equal(chunk.Address().Bytes(), receipt.Address.Bytes()) {
-		t.Fatal("chunk address do not match")
+	if err := protobuf.NewWriter(stream).WriteMsg(&pb.Delivery{
+		Address: closestPeer.Bytes(),
+		Data:    sch.Data(),
+	}); err != nil {
+		t.Fatal(err)
 	}
 
-	if !bytes.Equal([]byte{1}, receipt.Signature) {
-		t.Fatal("receipt signature is not present")
+	records := recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+	if !errors.Is(records[0].Err(), swarm.ErrInvalidChunk) {
+		t.Fatalf("got error %v, want %v", records[0].Err(), swarm.ErrInvalidChunk)
 	}
 }
 
-func createPushSyncNode(t *testing.T, addr swarm.Address, prices pricerParameters, recorder *streamtest.Recorder, unwrap func(swarm.Chunk), signer crypto.Signer, mockOpts ...mock.Option) (*pushsync.PushSync, *mocks.MockStorer, *tags.Tags, accounting.Interface) {
-	t.Helper()
-	mockAccounting := accountingmock.NewAccounting()
-	ps, mstorer, ts := createPushSyncNodeWithAccounting(t, addr, prices, recorder, unwrap, signer, mockAccounting, mockOpts...)
-	return ps, mstorer, ts, mockAccounting
-}
+// TestHandlerForwardCaching checks that forwarded chunks are stored by the
+// forwarding node only when forward caching is enabled.
+func TestHandlerForwardCaching(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
 
-func createPushSyncNodeWithAccounting(t *testing.T, addr swarm.Address, prices pricerParameters, recorder *streamtest.Recorder, unwrap func(swarm.Chunk), signer crypto.Signer, acct accounting.Interface, mockOpts ...mock.Option) (*pushsync.PushSync, *mocks.MockStorer, *tags.Tags) {
-	t.Helper()
-	logger := logging.New(ioutil.Discard, 0)
-	storer := mocks.NewStorer()
+	triggerPeer := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	pivotPeer := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
 
-	mockTopology := mock.NewTopologyDriver(mockOpts...)
-	mockStatestore := statestore.NewStateStore()
-	mtag := tags.NewTags(mockStatestore, logger)
+	for _, tc := range []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", enabled: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psClosest, storerClosest, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerClosest.Close()
 
-	mockPricer := pricermock.NewMockService(prices.price, prices.peerPrice)
+			closestRecorder := streamtest.New(streamtest.WithProtocols(psClosest.Protocol()), streamtest.WithBaseAddr(pivotPeer))
 
-	recorderDisconnecter := streamtest.NewRecorderDisconnecter(recorder)
-	if unwrap == nil {
-		unwrap = func(swarm.Chunk) {}
-	}
-	validStamp := func(ch swarm.Chunk, stamp []byte) (swarm.Chunk, error) {
-		return ch.WithStamp(postage.NewStamp(nil, nil)), nil
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotPeer, defaultPrices, closestRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithForwardCaching(tc.enabled)}, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			pivotRecorder := streamtest.New(streamtest.WithProtocols(psPivot.Protocol()), streamtest.WithBaseAddr(triggerPeer))
+
+			psTrigger, storerTrigger, _, _ := createPushSyncNode(t, triggerPeer, defaultPrices, pivotRecorder, nil, defaultSigner, mock.WithClosestPeer(pivotPeer))
+			defer storerTrigger.Close()
+
+			if _, err := psTrigger.PushChunkToClosest(context.Background(), chunk); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := storerPivot.Get(context.Background(), storage.ModeGetSync, chunk.Address())
+			if tc.enabled && err != nil {
+				t.Fatalf("chunk not cached on forward: %v", err)
+			}
+			if !tc.enabled && !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+			}
+		})
 	}
+}
+
+type chunkValidatorFunc func(swarm.Chunk) error
 
-	return pushsync.New(addr, recorderDisconnecter, storer, mockTopology, mtag, true, unwrap, validStamp, logger, acct, mockPricer, signer, nil), storer, mtag
+func (f chunkValidatorFunc) Validate(ch swarm.Chunk) error {
+	return f(ch)
 }
 
-func waitOnRecordAndTest(t *testing.T, peer swarm.Address, recorder *streamtest.Recorder, add swarm.Address, data []byte) {
-	t.Helper()
-	records := recorder.WaitRecords(t, peer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+// TestHandlerChunkValidator checks that delivered chunks are validated with
+// the configured chunk validator.
+func TestHandlerChunkValidator(t *testing.T) {
+	validChunk := testingc.FixtureChunk("7000")
+	// a chunk with an address that is neither a content address nor a
+	// single owner chunk address
+	invalidChunk := swarm.NewChunk(swarm.MustParseHexAddress("7100000000000000000000000000000000000000000000000000000000000000"), validChunk.Data()).WithStamp(validChunk.Stamp())
 
-	if data != nil {
-		messages, err := protobuf.ReadMessages(
-			bytes.NewReader(records[0].In()),
-			func() protobuf.Message { return new(pb.Delivery) },
-		)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if messages == nil {
-			t.Fatal("nil rcvd. for message")
-		}
-		if len(messages) > 1 {
-			t.Fatal("too many messages")
-		}
-		delivery := messages[0].(*pb.Delivery)
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
 
-		if !bytes.Equal(delivery.Address, add.Bytes()) {
-			t.Fatalf("chunk address mismatch")
-		}
+	for _, tc := range []struct {
+		name      string
+		chunk     swarm.Chunk
+		validator chunkValidatorFunc
+		wantValid bool
+	}{
+		{
+			name:  "rejected",
+			chunk: validChunk,
+			validator: func(swarm.Chunk) error {
+				return swarm.ErrInvalidChunk
+			},
+		},
+		{
+			name:  "accepted",
+			chunk: invalidChunk,
+			validator: func(swarm.Chunk) error {
+				return nil
+			},
+			wantValid: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithChunkValidator(tc.validator)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
 
-		if !bytes.Equal(delivery.Data, data) {
-			t.Fatalf("chunk data mismatch")
-		}
-	} else {
-		messages, err := protobuf.ReadMessages(
-			bytes.NewReader(records[0].In()),
-			func() protobuf.Message { return new(pb.Receipt) },
-		)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if messages == nil {
-			t.Fatal("nil rcvd. for message")
-		}
-		if len(messages) > 1 {
-			t.Fatal("too many messages")
-		}
-		receipt := messages[0].(*pb.Receipt)
-		receiptAddress := swarm.NewAddress(receipt.Address)
+			recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
 
-		if !receiptAddress.Equal(add) {
-			t.Fatalf("receipt address mismatch")
-		}
+			psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			_, err := psPivot.PushChunkToClosest(context.Background(), tc.chunk)
+			if tc.wantValid && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.wantValid && err == nil {
+				t.Fatal("expected error for rejected chunk")
+			}
+
+			_, err = storerPeer.Get(context.Background(), storage.ModeGetSync, tc.chunk.Address())
+			if tc.wantValid && err != nil {
+				t.Fatalf("accepted chunk not stored: %v", err)
+			}
+			if !tc.wantValid && !errors.Is(err, storage.ErrNotFound) {
+				t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+			}
+		})
 	}
 }
 
-func TestFailureRequestCache(t *testing.T) {
+type capacityCheckerFunc func() bool
+
+func (f capacityCheckerFunc) Full() bool {
+	return f()
+}
+
+// TestPushChunkToClosestStorageFull checks that peers with full storage
+// reject deliveries and that the chunk is pushed to another peer instead.
+func TestPushChunkToClosestStorageFull(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	full := capacityCheckerFunc(func() bool { return true })
+	psPeer1, storerPeer1, _ := createPushSyncNodeWithOptions(t, peer1, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithCapacityChecker(full)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer1.Close()
+
+	psPeer2, storerPeer2, _, _ := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer2.Close()
+
+	recorder := streamtest.New(
+		streamtest.WithPeerProtocols(
+			map[string]p2p.ProtocolSpec{
+				peer1.String(): psPeer1.Protocol(),
+				peer2.String(): psPeer2.Protocol(),
+			},
+		),
+		streamtest.WithBaseAddr(pivotNode),
+	)
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithPeers(peer1, peer2))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !peer2.Equal(receipt.Peer) {
+		t.Fatalf("got receipt peer %s, want %s", receipt.Peer, peer2)
+	}
+
+	if _, err := storerPeer1.Get(context.Background(), storage.ModeGetSync, chunk.Address()); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+	}
+
+	// a peer with full storage is never pushed to
+	_, err = psPivot.PushChunkToPeer(context.Background(), peer1, chunk)
+	if !errors.Is(err, pushsync.ErrStorageFull) {
+		t.Fatalf("got error %v, want %v", err, pushsync.ErrStorageFull)
+	}
+}
+
+type addressFilterFunc func(swarm.Address) bool
+
+func (f addressFilterFunc) Allowed(addr swarm.Address) bool {
+	return f(addr)
+}
+
+// TestHandlerAddressFilter checks that chunks denied by the address filter
+// are neither stored nor forwarded, while other chunks are.
+func TestHandlerAddressFilter(t *testing.T) {
+	allowed := testingc.FixtureChunk("7000")
+	denied := testingc.FixtureChunk("0025")
+	filter := addressFilterFunc(func(addr swarm.Address) bool {
+		return !addr.Equal(denied.Address())
+	})
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	forwarder := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+	storerNode := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	t.Run("store", func(t *testing.T) {
+		psPeer, storerPeer, _ := createPushSyncNodeWithOptions(t, storerNode, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithAddressFilter(filter)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+		defer storerPeer.Close()
+
+		recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+		psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(storerNode))
+		defer storerPivot.Close()
+
+		if _, err := psPivot.PushChunkToClosest(context.Background(), allowed); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := psPivot.PushChunkToClosest(context.Background(), denied); err == nil {
+			t.Fatal("expected error for denied chunk")
+		}
+
+		if _, err := storerPeer.Get(context.Background(), storage.ModeGetSync, denied.Address()); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+		}
+	})
+
+	t.Run("forward", func(t *testing.T) {
+		psStorer, storerStorer, _, _ := createPushSyncNode(t, storerNode, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+		defer storerStorer.Close()
+
+		storerRecorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(forwarder))
+
+		psForwarder, storerForwarder, _ := createPushSyncNodeWithOptions(t, forwarder, defaultPrices, storerRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithAddressFilter(filter)}, mock.WithClosestPeer(storerNode))
+		defer storerForwarder.Close()
+
+		recorder := streamtest.New(streamtest.WithProtocols(psForwarder.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+		psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(forwarder))
+		defer storerPivot.Close()
+
+		if _, err := psPivot.PushChunkToClosest(context.Background(), allowed); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := psPivot.PushChunkToClosest(context.Background(), denied); err == nil {
+			t.Fatal("expected error for denied chunk")
+		}
+
+		// only the allowed chunk is forwarded to the storer
+		records, err := storerRecorder.Records(storerNode, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("got %d forwarded deliveries, want 1", len(records))
+		}
+		if _, err := storerStorer.Get(context.Background(), storage.ModeGetSync, denied.Address()); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("got error %v, want %v", err, storage.ErrNotFound)
+		}
+	})
+}
+
+// TestPushSOCToClosest checks that single owner chunks are only pushed if
+// they are signed by the expected owner.
+func TestPushSOCToClosest(t *testing.T) {
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(key)
+	sch, err := soc.New(make([]byte, soc.IdSize), testingc.FixtureChunk("7000")).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch = sch.WithStamp(postagetesting.MustNewStamp())
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		chunk   swarm.Chunk
+		owner   []byte
+		wantErr error
+	}{
+		{
+			name:  "expected owner",
+			chunk: sch,
+			owner: owner.Bytes(),
+		},
+		{
+			name:    "other owner",
+			chunk:   sch,
+			owner:   postagetesting.MustNewAddress(),
+			wantErr: pushsync.ErrSOCOwnerMismatch,
+		},
+		{
+			name:    "content addressed chunk",
+			chunk:   testingc.FixtureChunk("7000"),
+			owner:   owner.Bytes(),
+			wantErr: swarm.ErrInvalidChunk,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			receipt, err := psPivot.PushSOCToClosest(context.Background(), tc.chunk, tc.owner)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tc.wantErr)
+				}
+				recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !receipt.Address.Equal(sch.Address()) {
+				t.Fatalf("got receipt address %s, want %s", receipt.Address, sch.Address())
+			}
+		})
+	}
+}
+
+// TestHandlerMaxHops checks that forwarded deliveries carry an incremented
+// hop count and that deliveries exceeding the maximum are rejected.
+func TestHandlerMaxHops(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	triggerPeer := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	pivotPeer := swarm.MustParseHexAddress("3000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	hopsHeaders := func(hops uint64) p2p.Headers {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, hops)
+		return p2p.Headers{"hops": b}
+	}
+
+	t.Run("forwarded", func(t *testing.T) {
+		psClosest, storerClosest, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+		defer storerClosest.Close()
+
+		headersC := make(chan p2p.Headers, 1)
+		recordHeaders := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+			return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+				headersC <- s.Headers()
+				return h(ctx, p, s)
+			}
+		}
+		closestRecorder := streamtest.New(streamtest.WithProtocols(psClosest.Protocol()), streamtest.WithBaseAddr(pivotPeer), streamtest.WithMiddlewares(recordHeaders))
+
+		psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotPeer, defaultPrices, closestRecorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithMaxHops(3)}, mock.WithClosestPeer(closestPeer))
+		defer storerPivot.Close()
+
+		recorder := streamtest.New(streamtest.WithProtocols(psPivot.Protocol()), streamtest.WithBaseAddr(triggerPeer))
+
+		psTrigger, storerTrigger, _ := createPushSyncNodeWithOptions(t, triggerPeer, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), nil, mock.WithClosestPeer(pivotPeer))
+		defer storerTrigger.Close()
+
+		if _, err := psTrigger.PushChunkToClosest(context.Background(), chunk); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := <-headersC; !bytes.Equal(got["hops"], hopsHeaders(2)["hops"]) {
+			t.Fatalf("got hops header %x, want %x", got["hops"], hopsHeaders(2)["hops"])
+		}
+	})
+
+	t.Run("exceeded", func(t *testing.T) {
+		psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotPeer, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithMaxHops(3)}, mock.WithClosestPeer(closestPeer))
+		defer storerPivot.Close()
+
+		recorder := streamtest.New(streamtest.WithProtocols(psPivot.Protocol()), streamtest.WithBaseAddr(triggerPeer))
+
+		stream, err := recorder.NewStream(context.Background(), pivotPeer, hopsHeaders(4), pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+
+		if err := protobuf.NewWriter(stream).WriteMsg(&pb.Delivery{
+			Address: chunk.Address().Bytes(),
+			Data:    chunk.Data(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		records := recorder.WaitRecords(t, pivotPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+		if !errors.Is(records[0].Err(), pushsync.ErrMaxHopsExceeded) {
+			t.Fatalf("got error %v, want %v", records[0].Err(), pushsync.ErrMaxHopsExceeded)
+		}
+	})
+}
+
+// TestHandlerStrictForwarding checks that deliveries from peers closer to
+// the chunk are rejected when strict forwarding is enabled.
+func TestHandlerStrictForwarding(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	senderPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name    string
+		strict  bool
+		wantErr error
+	}{
+		{
+			name:    "permissive",
+			strict:  false,
+			wantErr: topology.ErrNotFound,
+		},
+		{
+			name:    "strict",
+			strict:  true,
+			wantErr: pushsync.ErrUnexpectedDelivery,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithStrictForwarding(tc.strict)}, mock.WithClosestPeerErr(topology.ErrNotFound))
+			defer storerPivot.Close()
+
+			// the sender is a light node, so the delivery is not a replication
+			recorder := streamtest.New(streamtest.WithProtocols(psPivot.Protocol()), streamtest.WithBaseAddr(senderPeer), streamtest.WithLightNode())
+
+			stream, err := recorder.NewStream(context.Background(), pivotNode, nil, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+
+			if err := protobuf.NewWriter(stream).WriteMsg(&pb.Delivery{
+				Address: chunk.Address().Bytes(),
+				Data:    chunk.Data(),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			records := recorder.WaitRecords(t, pivotNode, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+			if !errors.Is(records[0].Err(), tc.wantErr) {
+				t.Fatalf("got error %v, want %v", records[0].Err(), tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestSenderDepthHeader checks that full nodes report their storage depth
+// to the peers they push chunks to, and that peers reject deliveries with a
+// malformed depth header.
+func TestSenderDepthHeader(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name    string
+		header  []byte
+		wantErr bool
+	}{
+		{name: "reported"},
+		{name: "malformed", header: []byte{1, 2}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			var got []byte
+			spec := psPeer.Protocol()
+			handler := spec.StreamSpecs[0].Handler
+			spec.StreamSpecs[0].Handler = func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+				got = s.Headers()[pushsync.SenderDepthHeader]
+				if tc.header != nil {
+					s.Headers()[pushsync.SenderDepthHeader] = tc.header
+				}
+				return handler(ctx, p, s)
+			}
+			recorder := streamtest.New(streamtest.WithProtocols(spec), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer), mock.WithNeighborhoodDepth(5))
+			defer storerPivot.Close()
+
+			_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error for malformed sender depth header")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte{5}) {
+				t.Fatalf("got sender depth header %x, want %x", got, []byte{5})
+			}
+		})
+	}
+}
+
+func TestSignsReceipt(t *testing.T) {
+
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	signer := cryptomock.New(cryptomock.WithSignFunc(func([]byte) ([]byte, error) {
+		return []byte{1}, nil
+	}))
+
+	// create a pivot node and a mocked closest node
+	pivotPeer := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	// Create the closest peer
+	psClosestPeer, closestStorerPeerDB, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, signer, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer closestStorerPeerDB.Close()
+
+	closestRecorder := streamtest.New(streamtest.WithProtocols(psClosestPeer.Protocol()), streamtest.WithBaseAddr(pivotPeer))
+
+	// creating the pivot peer who will act as a forwarder node with a higher price (17)
+	psPivot, storerPivotDB, _, _ := createPushSyncNode(t, pivotPeer, defaultPrices, closestRecorder, nil, signer, mock.WithClosestPeer(closestPeer))
+	defer storerPivotDB.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !chunk.Address().Equal(receipt.Address) {
+		t.Fatal("invalid receipt")
+	}
+
+	if !bytes.Equal(chunk.Address().Bytes(), receipt.Address.Bytes()) {
+		t.Fatal("chunk address do not match")
+	}
+
+	if !bytes.Equal([]byte{1}, receipt.Signature) {
+		t.Fatal("receipt signature is not present")
+	}
+}
+
+// TestPushChunkToClosestMaxPeers checks that the originator gives up after
+// the configured number of peers have been attempted.
+func TestPushChunkToClosestMaxPeers(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer1, storerPeer1, _, _ := createPushSyncNode(t, peer1, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer1.Close()
+
+	psPeer2, storerPeer2, _, _ := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer2.Close()
+
+	recorder := streamtest.New(
+		streamtest.WithProtocols(
+			psPeer1.Protocol(),
+			psPeer2.Protocol(),
+		),
+		streamtest.WithMiddlewares(
+			func(h p2p.HandlerFunc) p2p.HandlerFunc {
+				return func(ctx context.Context, peer p2p.Peer, stream p2p.Stream) error {
+					// the closest peer always fails
+					stream.Close()
+					return errors.New("peer not reachable")
+				}
+			},
+		),
+		streamtest.WithBaseAddr(pivotNode),
+	)
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithMaxPeers(1)}, mock.WithPeers(peer1, peer2))
+	defer storerPivot.Close()
+
+	_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if !errors.Is(err, pushsync.ErrNoReceipt) {
+		t.Fatalf("got error %v, want %v", err, pushsync.ErrNoReceipt)
+	}
+
+	if errors.Unwrap(err) == nil {
+		t.Fatal("expected the last push error to be wrapped")
+	}
+
+	var pushErr *pushsync.PushError
+	if !errors.As(err, &pushErr) {
+		t.Fatalf("got error %T, want %T", err, pushErr)
+	}
+	if len(pushErr.Errors) != 1 || !pushErr.Peers[0].Equal(peer1) {
+		t.Fatalf("got %d push errors, want 1 for peer %s", len(pushErr.Errors), peer1)
+	}
+
+	// only the closest peer should have been attempted
+	_, err = recorder.Records(peer2, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName)
+	if !errors.Is(err, streamtest.ErrRecordsNotFound) {
+		t.Fatalf("got error %v, want %v", err, streamtest.ErrRecordsNotFound)
+	}
+}
+
+// TestPushChunkToClosestRequestTTL checks that a push to a peer that does not
+// respond fails after the time to live set with WithRequestTTL.
+func TestPushChunkToClosestRequestTTL(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	// the peer does not handle the delivery until the push is done
+	release := make(chan struct{})
+	defer close(release)
+	blockHandler := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+		return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+			<-release
+			return h(ctx, p, s)
+		}
+	}
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithMiddlewares(blockHandler))
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithRequestTTL(100 * time.Millisecond)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	start := time.Now()
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err == nil {
+		t.Fatal("expected error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("push failed after %v, want the request ttl", elapsed)
+	}
+}
+
+// TestPeersSkipped checks that every peer added to the skip list of a push is
+// counted.
+func TestPeersSkipped(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer1, storerPeer1, _, _ := createPushSyncNode(t, peer1, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer1.Close()
+
+	psPeer2, storerPeer2, _, _ := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer2.Close()
+
+	recorder := streamtest.New(
+		streamtest.WithProtocols(
+			psPeer1.Protocol(),
+			psPeer2.Protocol(),
+		),
+		streamtest.WithStreamError(
+			func(addr swarm.Address, _, _, _ string) error {
+				// the closest peer always fails
+				if addr.Equal(peer1) {
+					return errors.New("peer not reachable")
+				}
+				return nil
+			},
+		),
+		streamtest.WithBaseAddr(pivotNode),
+	)
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithPeers(peer1, peer2))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !peer2.Equal(receipt.Peer) {
+		t.Fatalf("got receipt peer %s, want %s", receipt.Peer, peer2)
+	}
+
+	// both peers are skipped once they are tried
+	if got := metricValue(t, psPivot, "pushsync_total_peers_skipped"); got != 2 {
+		t.Fatalf("got %v peers skipped, want 2", got)
+	}
+}
+
+// TestPushChunkToClosestReceiptVerification checks that receipts are only
+// accepted when they are signed by a plausible storer of the chunk.
+func TestPushChunkToClosestReceiptVerification(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	networkID := uint64(1)
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closestPeer, err := crypto.NewOverlayAddress(key.PublicKey, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		signer  crypto.Signer
+		wantErr bool
+	}{
+		{
+			name:   "valid signature",
+			signer: crypto.NewDefaultSigner(key),
+		},
+		{
+			name:    "invalid signature",
+			signer:  defaultSigner,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, tc.signer, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithReceiptVerification(networkID)}, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+			if tc.wantErr && err == nil {
+				t.Fatal("expected error for invalid receipt signature")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestPushChunkToClosestRequireNeighborhoodReceipt checks that receipts are
+// only accepted when they are signed within the neighborhood of the chunk.
+func TestPushChunkToClosestRequireNeighborhoodReceipt(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	networkID := uint64(1)
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closestPeer, err := crypto.NewOverlayAddress(key.PublicKey, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	po := swarm.Proximity(closestPeer.Bytes(), chunk.Address().Bytes())
+
+	for _, tc := range []struct {
+		name    string
+		depth   uint8
+		wantErr error
+	}{
+		{
+			name:  "within depth",
+			depth: po,
+		},
+		{
+			name:    "outside depth",
+			depth:   po + 1,
+			wantErr: pushsync.ErrReceiptOutsideDepth,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, crypto.NewDefaultSigner(key), mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithReceiptVerification(networkID), pushsync.WithRequireNeighborhoodReceipt(true)}, mock.WithClosestPeer(closestPeer), mock.WithNeighborhoodDepth(tc.depth))
+			defer storerPivot.Close()
+
+			_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+			if tc.wantErr == nil && err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestPushChunksToClosest checks that chunks with the same closest peer are
+// delivered over a single stream and a receipt is returned for each of them.
+func TestPushChunksToClosest(t *testing.T) {
+	chunks := []swarm.Chunk{
+		testingc.FixtureChunk("7000"),
+		testingc.FixtureChunk("0025"),
+		testingc.FixtureChunk("0033"),
+	}
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, peerAccounting := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, pivotAccounting := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	receipts, errs := psPivot.PushChunksToClosest(context.Background(), chunks)
+	for i, ch := range chunks {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !ch.Address().Equal(receipts[i].Address) {
+			t.Fatalf("invalid receipt for chunk %d", i)
+		}
+		if !closestPeer.Equal(receipts[i].Peer) {
+			t.Fatalf("got receipt peer %s, want %s", receipts[i].Peer, closestPeer)
+		}
+	}
+
+	records := recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.BatchStreamName, 1, 5)
+	messages, err := protobuf.ReadMessages(
+		bytes.NewReader(records[0].In()),
+		func() protobuf.Message { return new(pb.Delivery) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != len(chunks) {
+		t.Fatalf("got %d deliveries, want %d", len(messages), len(chunks))
+	}
+	// the chunks are pushed concurrently, so they are delivered in any order
+	delivered := make(map[string]bool)
+	for _, m := range messages {
+		delivered[string(m.(*pb.Delivery).Address)] = true
+	}
+	for i, ch := range chunks {
+		if !delivered[string(ch.Address().Bytes())] {
+			t.Fatalf("chunk %d not delivered", i)
+		}
+	}
+
+	want := int64(fixedPrice) * int64(len(chunks))
+
+	balance, err := pivotAccounting.Balance(closestPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != -want {
+		t.Fatalf("unexpected balance on pivot. want %d got %d", -want, balance)
+	}
+
+	balance, err = peerAccounting.Balance(pivotNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != want {
+		t.Fatalf("unexpected balance on peer. want %d got %d", want, balance)
+	}
+}
+
+// TestPushChunkToClosestTagIncrementError checks that a failure to increment
+// the sent counter of the tag of a chunk fails the push only with
+// WithStrictTags.
+func TestPushChunkToClosestTagIncrementError(t *testing.T) {
+	pushsync.SetIncTag(func(*tags.Tag, tags.State) error {
+		return errors.New("tag increment")
+	})
+	defer pushsync.SetIncTag((*tags.Tag).Inc)
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name    string
+		strict  bool
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "strict", strict: true, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, pivotTags := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithStrictTags(tc.strict)}, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			ta, err := pivotTags.Create(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunk := testingc.FixtureChunk("7000").WithTagID(ta.Uid)
+
+			receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !chunk.Address().Equal(receipt.Address) {
+				t.Fatal("invalid receipt")
+			}
+
+			if got := metricValue(t, psPivot, "pushsync_total_tag_increment_errors"); got != 1 {
+				t.Fatalf("got %v tag increment errors, want 1", got)
+			}
+		})
+	}
+}
+
+// TestPushChunksToClosestFailure checks that chunks are delivered on streams
+// of their own to a peer that does not accept batch streams, without counting
+// it against the peer.
+func TestPushChunksToClosestFailure(t *testing.T) {
+	chunks := []swarm.Chunk{
+		testingc.FixtureChunk("7000"),
+		testingc.FixtureChunk("0033"),
+	}
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	// the peer does not accept batch streams
+	batchStreamErr := func(_ swarm.Address, _, _, streamName string) error {
+		if streamName == pushsync.BatchStreamName {
+			return errors.New("batch stream refused")
+		}
+		return nil
+	}
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithStreamError(batchStreamErr))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	receipts, errs := psPivot.PushChunksToClosest(context.Background(), chunks)
+	for i, ch := range chunks {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !ch.Address().Equal(receipts[i].Address) {
+			t.Fatalf("invalid receipt for chunk %d", i)
+		}
+	}
+
+	if got := metricValue(t, psPivot, "pushsync_total_failed_send_attempts"); got != 0 {
+		t.Fatalf("got %v failed send attempts, want 0", got)
+	}
+	recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, len(chunks), 5)
+}
+
+// TestPushChunksToClosestOptions checks that the chunks pushed by
+// PushChunksToClosest are pushed with the options of PushChunkToClosest.
+func TestPushChunksToClosestOptions(t *testing.T) {
+	chunks := []swarm.Chunk{
+		testingc.FixtureChunk("7000"),
+		testingc.FixtureChunk("0033"),
+	}
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	hookCalls := make(chan swarm.Address, len(chunks))
+	hook := func(chunk, _ swarm.Address, _ *pushsync.Receipt) {
+		hookCalls <- chunk
+	}
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithDeliveryAck(true), pushsync.WithReceiptHook(hook)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	_, errs := psPivot.PushChunksToClosest(context.Background(), chunks)
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the peer acknowledges every delivery before its receipt
+	records := recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.BatchStreamName, 1, 5)
+	messages, err := protobuf.ReadMessages(
+		bytes.NewReader(records[0].Out()),
+		func() protobuf.Message { return new(pb.Receipt) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2*len(chunks) {
+		t.Fatalf("got %d messages from the peer, want %d", len(messages), 2*len(chunks))
+	}
+
+	for range chunks {
+		select {
+		case <-hookCalls:
+		case <-time.After(5 * time.Second):
+			t.Fatal("receipt hook not called")
+		}
+	}
+}
+
+// TestPushChunksToClosestStoreOnSelf checks that the chunks that this node is
+// the closest to are stored with WithStoreOnSelf.
+func TestPushChunksToClosestStoreOnSelf(t *testing.T) {
+	chunks := []swarm.Chunk{
+		testingc.FixtureChunk("7000"),
+		testingc.FixtureChunk("0033"),
+	}
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithStoreOnSelf(true)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPivot.Close()
+
+	receipts, errs := psPivot.PushChunksToClosest(context.Background(), chunks)
+	for i, ch := range chunks {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !pivotNode.Equal(receipts[i].Peer) {
+			t.Fatalf("got receipt peer %s, want %s", receipts[i].Peer, pivotNode)
+		}
+		if _, err := storerPivot.Get(context.Background(), storage.ModeGetSync, ch.Address()); err != nil {
+			t.Fatalf("chunk %d not stored: %v", i, err)
+		}
+	}
+}
+
+// TestClosestPeer checks that the peer a chunk would be pushed to is resolved
+// without sending the chunk.
+func TestClosestPeer(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, pivotAccounting := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	peer, price, err := psPivot.ClosestPeer(context.Background(), chunk.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !peer.Equal(closestPeer) {
+		t.Fatalf("got peer %s, want %s", peer, closestPeer)
+	}
+	if price != fixedPrice {
+		t.Fatalf("got price %d, want %d", price, fixedPrice)
+	}
+
+	recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+
+	balance, err := pivotAccounting.Balance(closestPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != 0 {
+		t.Fatalf("unexpected balance on pivot. want %d got %d", 0, balance)
+	}
+}
+
+// TestPushChunkToClosestExcluding checks that the excluded peers are never
+// selected for the push.
+func TestPushChunkToClosestExcluding(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer1, storerPeer1, _, _ := createPushSyncNode(t, peer1, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer1.Close()
+
+	psPeer2, storerPeer2, _, _ := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer2.Close()
+
+	recorder := streamtest.New(
+		streamtest.WithPeerProtocols(
+			map[string]p2p.ProtocolSpec{
+				peer1.String(): psPeer1.Protocol(),
+				peer2.String(): psPeer2.Protocol(),
+			},
+		),
+		streamtest.WithBaseAddr(pivotNode),
+	)
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithPeers(peer1, peer2))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosestExcluding(context.Background(), chunk, []swarm.Address{peer1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !peer2.Equal(receipt.Peer) {
+		t.Fatalf("got receipt peer %s, want %s", receipt.Peer, peer2)
+	}
+
+	recorder.WaitRecords(t, peer1, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+}
+
+// TestPushChunkToClosestN checks that receipts are collected from distinct
+// peers and that the receipts collected so far are returned together with a
+// partial push error when the peers are exhausted.
+func TestPushChunkToClosestN(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer1, storerPeer1, _, _ := createPushSyncNode(t, peer1, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer1.Close()
+
+	psPeer2, storerPeer2, _, _ := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer2.Close()
+
+	recorder := streamtest.New(
+		streamtest.WithPeerProtocols(
+			map[string]p2p.ProtocolSpec{
+				peer1.String(): psPeer1.Protocol(),
+				peer2.String(): psPeer2.Protocol(),
+			},
+		),
+		streamtest.WithBaseAddr(pivotNode),
+	)
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithPeers(peer1, peer2))
+	defer storerPivot.Close()
+
+	t.Run("all receipts", func(t *testing.T) {
+		receipts, err := psPivot.PushChunkToClosestN(context.Background(), chunk, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(receipts) != 2 {
+			t.Fatalf("got %d receipts, want 2", len(receipts))
+		}
+		if receipts[0].Peer.Equal(receipts[1].Peer) {
+			t.Fatalf("got receipts from the same peer %s", receipts[0].Peer)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		receipts, err := psPivot.PushChunkToClosestN(context.Background(), chunk, 3)
+		if !errors.Is(err, pushsync.ErrPartialPush) {
+			t.Fatalf("got error %v, want %v", err, pushsync.ErrPartialPush)
+		}
+		if !errors.Is(err, topology.ErrNotFound) {
+			t.Fatalf("got error %v, want %v", err, topology.ErrNotFound)
+		}
+		if len(receipts) != 2 {
+			t.Fatalf("got %d receipts, want 2", len(receipts))
+		}
+	})
+}
+
+// TestPushChunkToClosestToSelf checks that ErrClosestToSelf is returned when
+// the pushing node is the closest to the chunk.
+func TestPushChunkToClosestToSelf(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPivot.Close()
+
+	_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if !errors.Is(err, pushsync.ErrClosestToSelf) {
+		t.Fatalf("got error %v, want %v", err, pushsync.ErrClosestToSelf)
+	}
+	if !errors.Is(err, topology.ErrWantSelf) {
+		t.Fatalf("got error %v, want %v", err, topology.ErrWantSelf)
+	}
+}
+
+// TestPushChunkToClosestStoreOnSelf checks that the chunk is stored locally
+// and a receipt signed by the pushing node is returned when it is the closest
+// to the chunk and storing on self is enabled.
+func TestPushChunkToClosestStoreOnSelf(t *testing.T) {
+	networkID := uint64(1)
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := crypto.NewOverlayAddress(key.PublicKey, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, nil, nil, crypto.NewDefaultSigner(key), accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithStoreOnSelf(true)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chunk.Address().Equal(receipt.Address) {
+		t.Fatalf("got receipt address %s, want %s", receipt.Address, chunk.Address())
+	}
+	if !pivotNode.Equal(receipt.Peer) {
+		t.Fatalf("got receipt peer %s, want %s", receipt.Peer, pivotNode)
+	}
+
+	signer, err := pushsync.ValidateReceipt(receipt, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.Equal(overlay) {
+		t.Fatalf("got signer %s, want %s", signer, overlay)
+	}
+
+	if _, err := storerPivot.Get(context.Background(), storage.ModeGetSync, chunk.Address()); err != nil {
+		t.Fatalf("chunk not stored: %v", err)
+	}
+}
+
+// TestPushChunkToClosestClosed checks that no chunks are pushed after
+// PushSync is closed.
+func TestPushChunkToClosestClosed(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if err := psPivot.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// closing again is a no-op
+	if err := psPivot.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if !errors.Is(err, pushsync.ErrClosed) {
+		t.Fatalf("got error %v, want %v", err, pushsync.ErrClosed)
+	}
+
+	recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+}
+
+func TestValidateReceipt(t *testing.T) {
+	networkID := uint64(1)
+	chunk := testingc.FixtureChunk("7000")
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := crypto.NewOverlayAddress(key.PublicKey, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := crypto.NewDefaultSigner(key).Sign(pushsync.ReceiptPayload(chunk.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := pushsync.ValidateReceipt(&pushsync.Receipt{Address: chunk.Address(), Signature: signature}, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.Equal(overlay) {
+		t.Fatalf("got signer %s, want %s", signer, overlay)
+	}
+
+	_, err = pushsync.ValidateReceipt(&pushsync.Receipt{Address: chunk.Address(), Signature: []byte{1}}, networkID)
+	if err == nil {
+		t.Fatal("expected error for malformed signature")
+	}
+}
+
+// TestProofOfCustody checks that receipts sign the custody digest of the
+// chunk if proof of custody is enabled and supported by the peer, and the
+// chunk address otherwise.
+func TestProofOfCustody(t *testing.T) {
+	networkID := uint64(1)
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := crypto.NewOverlayAddress(key.PublicKey, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(key)
+
+	for _, tc := range []struct {
+		name        string
+		enabled     bool
+		legacyPeer  bool
+		wantCustody bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", enabled: true, wantCustody: true},
+		{name: "legacy peer", enabled: true, legacyPeer: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, signer, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			spec := psPeer.Protocol()
+			if tc.legacyPeer {
+				// a peer that does not know the custody header
+				handler := spec.StreamSpecs[0].Handler
+				spec.StreamSpecs[0].Handler = func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+					delete(s.Headers(), pushsync.CustodyHeader)
+					return handler(ctx, p, s)
+				}
+				spec.StreamSpecs[0].Headler = nil
+			}
+			recorder := streamtest.New(streamtest.WithProtocols(spec), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithProofOfCustody(tc.enabled)}, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if receipt.Custody != tc.wantCustody {
+				t.Fatalf("got custody %v, want %v", receipt.Custody, tc.wantCustody)
+			}
+
+			var got swarm.Address
+			if tc.wantCustody {
+				got, err = pushsync.ValidateCustodyReceipt(receipt, chunk, networkID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := pushsync.ValidateReceipt(receipt, networkID); err == nil {
+					t.Fatal("expected error for receipt with proof of custody")
+				}
+			} else {
+				got, err = pushsync.ValidateReceipt(receipt, networkID)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !got.Equal(overlay) {
+				t.Fatalf("got signer %s, want %s", got, overlay)
+			}
+		})
+	}
+}
+
+type peerSelectorFunc func(swarm.Address, []swarm.Address) (swarm.Address, error)
+
+func (f peerSelectorFunc) Next(addr swarm.Address, skip []swarm.Address) (swarm.Address, error) {
+	return f(addr, skip)
+}
+
+type inclusionProverFunc func(swarm.Address) (*pushsync.InclusionProof, error)
+
+func (f inclusionProverFunc) InclusionProof(addr swarm.Address) (*pushsync.InclusionProof, error) {
+	return f(addr)
+}
+
+// TestInclusionProof checks that receipts carry the verified inclusion proof
+// of the storer if inclusion proofs are enabled and supported by the peer,
+// and that plain receipts are returned otherwise.
+func TestInclusionProof(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	// a tree with the chunk and a sibling leaf
+	sibling := swarm.MustParseHexAddress("8000000000000000000000000000000000000000000000000000000000000000").Bytes()
+	root, err := crypto.LegacyKeccak256(append(chunk.Address().Bytes(), sibling...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validProof := &pushsync.InclusionProof{Root: root, Index: 0, Segments: [][]byte{sibling}}
+	invalidProof := &pushsync.InclusionProof{Root: root, Index: 1, Segments: [][]byte{sibling}}
+
+	for _, tc := range []struct {
+		name       string
+		enabled    bool
+		proof      *pushsync.InclusionProof
+		legacyPeer bool
+		wantProof  bool
+		wantErr    error
+	}{
+		{name: "disabled", proof: validProof},
+		{name: "valid proof", enabled: true, proof: validProof, wantProof: true},
+		{name: "no proof", enabled: true},
+		{name: "invalid proof", enabled: true, proof: invalidProof, wantErr: pushsync.ErrInvalidInclusionProof},
+		{name: "legacy peer", enabled: true, proof: validProof, legacyPeer: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prover := inclusionProverFunc(func(swarm.Address) (*pushsync.InclusionProof, error) {
+				return tc.proof, nil
+			})
+			psPeer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithInclusionProver(prover)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			spec := psPeer.Protocol()
+			if tc.legacyPeer {
+				// a peer that does not know the inclusion proof header
+				handler := spec.StreamSpecs[0].Handler
+				spec.StreamSpecs[0].Handler = func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+					delete(s.Headers(), pushsync.InclusionProofHeader)
+					return handler(ctx, p, s)
+				}
+				spec.StreamSpecs[0].Headler = nil
+			}
+			recorder := streamtest.New(streamtest.WithProtocols(spec), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithInclusionProofs(tc.enabled), pushsync.WithMaxPeers(1)}, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := receipt.InclusionProof != nil; got != tc.wantProof {
+				t.Fatalf("got inclusion proof %v, want %v", got, tc.wantProof)
+			}
+			if tc.wantProof && !bytes.Equal(receipt.InclusionProof.Root, root) {
+				t.Fatalf("got proof root %x, want %x", receipt.InclusionProof.Root, root)
+			}
+		})
+	}
+}
+
+// TestPushChunkToClosestPeerSelector checks that the configured peer selector
+// is used instead of the closest peer.
+func TestPushChunkToClosestPeerSelector(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	selectedPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, selectedPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	selector := peerSelectorFunc(func(swarm.Address, []swarm.Address) (swarm.Address, error) {
+		return selectedPeer, nil
+	})
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithPeerSelector(selector)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !selectedPeer.Equal(receipt.Peer) {
+		t.Fatalf("got receipt peer %s, want %s", receipt.Peer, selectedPeer)
+	}
+
+	waitOnRecordAndTest(t, selectedPeer, recorder, chunk.Address(), chunk.Data())
+}
+
+// TestPushChunkToClosestStickyRouting checks that the peer that returned the
+// last receipt for a chunk is tried first with sticky routing, instead of the
+// peer that would be selected otherwise.
+func TestPushChunkToClosestStickyRouting(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer1, storerPeer1, _, _ := createPushSyncNode(t, peer1, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer1.Close()
+
+	psPeer2, storerPeer2, _, _ := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer2.Close()
+
+	recorder := streamtest.New(
+		streamtest.WithPeerProtocols(
+			map[string]p2p.ProtocolSpec{
+				peer1.String(): psPeer1.Protocol(),
+				peer2.String(): psPeer2.Protocol(),
+			},
+		),
+		streamtest.WithBaseAddr(pivotNode),
+	)
+
+	var (
+		mtx      sync.Mutex
+		selected = peer1
+	)
+	selector := peerSelectorFunc(func(swarm.Address, []swarm.Address) (swarm.Address, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return selected, nil
+	})
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithPeerSelector(selector), pushsync.WithStickyRouting(true)}, mock.WithPeers(peer1, peer2))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !peer1.Equal(receipt.Peer) {
+		t.Fatalf("got receipt peer %s, want %s", receipt.Peer, peer1)
+	}
+
+	mtx.Lock()
+	selected = peer2
+	mtx.Unlock()
+
+	receipt, err = psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !peer1.Equal(receipt.Peer) {
+		t.Fatalf("got receipt peer %s, want sticky peer %s", receipt.Peer, peer1)
+	}
+
+	recorder.WaitRecords(t, peer1, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 2, 5)
+	recorder.WaitRecords(t, peer2, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+}
+
+// TestPushChunkToClosestDeduplication checks that concurrent pushes of the
+// same chunk are sent to the network only once when deduplication is enabled.
+func TestPushChunkToClosestDeduplication(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	var (
+		selected int32
+		release  = make(chan struct{})
+	)
+	// block the first push until the second one is started
+	selector := peerSelectorFunc(func(swarm.Address, []swarm.Address) (swarm.Address, error) {
+		atomic.AddInt32(&selected, 1)
+		<-release
+		return closestPeer, nil
+	})
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithPeerSelector(selector), pushsync.WithDeduplication(true)})
+	defer storerPivot.Close()
+
+	const pushes = 2
+	var wg sync.WaitGroup
+	receipts := make([]*pushsync.Receipt, pushes)
+	errs := make([]error, pushes)
+	for i := 0; i < pushes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			receipts[i], errs[i] = psPivot.PushChunkToClosest(context.Background(), chunk)
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := 0; i < pushes; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !chunk.Address().Equal(receipts[i].Address) {
+			t.Fatalf("got receipt address %s, want %s", receipts[i].Address, chunk.Address())
+		}
+	}
+	if receipts[0] == receipts[1] {
+		t.Fatal("receipt shared between callers")
+	}
+
+	if got := atomic.LoadInt32(&selected); got != 1 {
+		t.Fatalf("got %v peer selections, want 1", got)
+	}
+
+	recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+}
+
+func TestPushChunkToClosestWithRetry(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+
+	policy := pushsync.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+	}
+
+	for _, tc := range []struct {
+		name         string
+		err          error
+		wantAttempts int32
+	}{
+		{
+			name:         "retryable",
+			err:          topology.ErrNotFound,
+			wantAttempts: 3,
+		},
+		{
+			name:         "not retryable",
+			err:          topology.ErrWantSelf,
+			wantAttempts: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts int32
+			selector := peerSelectorFunc(func(swarm.Address, []swarm.Address) (swarm.Address, error) {
+				atomic.AddInt32(&attempts, 1)
+				return swarm.ZeroAddress, tc.err
+			})
+
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithPeerSelector(selector)})
+			defer storerPivot.Close()
+
+			_, err := psPivot.PushChunkToClosestWithRetry(context.Background(), chunk, policy)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+
+			if got := atomic.LoadInt32(&attempts); got != tc.wantAttempts {
+				t.Fatalf("got %v attempts, want %v", got, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestReceiptHook(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	type hookCall struct {
+		chunk, peer swarm.Address
+		receipt     *pushsync.Receipt
+	}
+	calls := make(chan hookCall, 1)
+	hook := func(chunk, peer swarm.Address, r *pushsync.Receipt) {
+		calls <- hookCall{chunk: chunk, peer: peer, receipt: r}
+	}
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithReceiptHook(hook)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-calls:
+		if !c.chunk.Equal(chunk.Address()) {
+			t.Fatalf("got chunk %s, want %s", c.chunk, chunk.Address())
+		}
+		if !c.peer.Equal(closestPeer) {
+			t.Fatalf("got peer %s, want %s", c.peer, closestPeer)
+		}
+		if !c.receipt.Address.Equal(receipt.Address) {
+			t.Fatalf("got receipt address %s, want %s", c.receipt.Address, receipt.Address)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("receipt hook not called")
+	}
+}
+
+func TestDeliveryObserver(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	var (
+		peers      []swarm.Address
+		deliveries []*pb.Delivery
+	)
+	observer := func(peer swarm.Address, d *pb.Delivery) {
+		peers = append(peers, peer)
+		deliveries = append(deliveries, d)
+		// the observer must not be able to change the written delivery
+		d.Data[0]++
+	}
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithDeliveryObserver(observer)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d observed deliveries, want 1", len(deliveries))
+	}
+	if !peers[0].Equal(closestPeer) {
+		t.Fatalf("got peer %s, want %s", peers[0], closestPeer)
+	}
+	if !bytes.Equal(deliveries[0].Address, chunk.Address().Bytes()) {
+		t.Fatalf("got delivery address %x, want %s", deliveries[0].Address, chunk.Address())
+	}
+
+	// the written delivery is not changed by the observer
+	waitOnRecordAndTest(t, closestPeer, recorder, chunk.Address(), chunk.Data())
+}
+
+func TestMetrics(t *testing.T) {
+	ps, storer, _, _ := createPushSyncNode(t, swarm.ZeroAddress, defaultPrices, nil, nil, defaultSigner)
+	defer storer.Close()
+
+	collectors := ps.Metrics()
+	if len(collectors) == 0 {
+		t.Fatal("no metrics collectors")
+	}
+
+	registry := prometheus.NewRegistry()
+	for _, c := range collectors {
+		if err := registry.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestDeliveriesByRole checks that every handled delivery is counted once
+// with the role of the node.
+func TestDeliveriesByRole(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	forwarder := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+	storerNode := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psStorer, storerStorer, _, _ := createPushSyncNode(t, storerNode, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerStorer.Close()
+
+	storerRecorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(forwarder))
+
+	psForwarder, storerForwarder, _, _ := createPushSyncNode(t, forwarder, defaultPrices, storerRecorder, nil, defaultSigner, mock.WithClosestPeer(storerNode))
+	defer storerForwarder.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psForwarder.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(forwarder))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		ps   *pushsync.PushSync
+		want map[string]float64
+	}{
+		{name: "forwarder", ps: psForwarder, want: map[string]float64{"forward": 1}},
+		{name: "storer", ps: psStorer, want: map[string]float64{"terminal": 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := deliveriesByRole(t, tc.ps); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got deliveries by role %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestDeliveriesByRoleRejected checks that a rejected delivery is counted
+// with the role of the node.
+func TestDeliveriesByRoleRejected(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	secondPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	// the replica rejects the chunk as out of its depth
+	psSecond, storerSecond, _, _ := createPushSyncNode(t, secondPeer, defaultPrices, nil, nil, defaultSigner, mock.WithIsWithinFunc(func(swarm.Address) bool { return false }))
+	defer storerSecond.Close()
+	secondRecorder := streamtest.New(streamtest.WithProtocols(psSecond.Protocol()), streamtest.WithBaseAddr(closestPeer))
+
+	psStorer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, secondRecorder, nil, defaultSigner, accountingmock.NewAccounting(), nil, mock.WithPeers(secondPeer), mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+	recorder := streamtest.New(streamtest.WithProtocols(psStorer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	secondRecorder.WaitRecords(t, secondPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+
+	want := map[string]float64{"replica": 1}
+	if got := deliveriesByRole(t, psSecond); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got deliveries by role %v, want %v", got, want)
+	}
+}
+
+// TestTrailingData checks that data sent by a peer after the receipt is
+// counted without failing the push, whether it arrives together with the
+// receipt or after it.
+func TestTrailingData(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		duplicate bool
+		separate  bool
+		want      float64
+	}{
+		{name: "none"},
+		{name: "single write", duplicate: true, want: 1},
+		{name: "separate writes", duplicate: true, separate: true, want: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// chunk data to upload
+			chunk := testingc.FixtureChunk("7000")
+
+			pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+			closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			// the peer writes the receipt twice
+			duplicate := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+				return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+					if !tc.duplicate {
+						return h(ctx, p, s)
+					}
+					return h(ctx, p, &duplicatingStream{Stream: s, separate: tc.separate})
+				}
+			}
+			recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithMiddlewares(duplicate))
+
+			psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := metricValue(t, psPivot, "pushsync_total_trailing_data"); got != tc.want {
+				t.Fatalf("got %v streams with trailing data, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// duplicatingStream is a stream that writes the data of every write twice,
+// either in a single write or in two separate ones.
+type duplicatingStream struct {
+	p2p.Stream
+	separate bool
+}
+
+func (s *duplicatingStream) Write(p []byte) (int, error) {
+	if s.separate {
+		if _, err := s.Stream.Write(p); err != nil {
+			return 0, err
+		}
+		if _, err := s.Stream.Write(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if _, err := s.Stream.Write(append(p[:len(p):len(p)], p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// metricValue returns the value of the pushsync counter with the name
+// suffix.
+func metricValue(t *testing.T, ps *pushsync.PushSync, name string) float64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	for _, c := range ps.Metrics() {
+		if err := registry.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if strings.HasSuffix(f.GetName(), name) {
+			return f.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// deliveriesByRole returns the values of the deliveries by role counter of
+// the pushsync metrics by role.
+func deliveriesByRole(t *testing.T, ps *pushsync.PushSync) map[string]float64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	for _, c := range ps.Metrics() {
+		if err := registry.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := make(map[string]float64)
+	for _, f := range families {
+		if !strings.HasSuffix(f.GetName(), "pushsync_deliveries_by_role") {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "role" {
+					roles[l.GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return roles
+}
+
+// histograms returns the pushsync histograms with the given name by the value
+// of their label, or by an empty string for a histogram without labels.
+func histograms(t *testing.T, ps *pushsync.PushSync, name string) map[string]*dto.Histogram {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	for _, c := range ps.Metrics() {
+		if err := registry.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := make(map[string]*dto.Histogram)
+	for _, f := range families {
+		if !strings.HasSuffix(f.GetName(), name) {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			var label string
+			for _, l := range m.GetLabel() {
+				label = l.GetValue()
+			}
+			hs[label] = m.GetHistogram()
+		}
+	}
+	return hs
+}
+
+// TestPeersTriedPerPush checks that the number of peers tried is recorded for
+// successful and failed pushes.
+func TestPeersTriedPerPush(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer1 := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	peer2 := swarm.MustParseHexAddress("5000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer1, storerPeer1, _, _ := createPushSyncNode(t, peer1, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer1.Close()
+
+	psPeer2, storerPeer2, _, _ := createPushSyncNode(t, peer2, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer2.Close()
+
+	var (
+		lock sync.Mutex
+		fail = true
+	)
+	recorder := streamtest.New(
+		streamtest.WithProtocols(
+			psPeer1.Protocol(),
+			psPeer2.Protocol(),
+		),
+		streamtest.WithStreamError(
+			func(swarm.Address, string, string, string) error {
+				lock.Lock()
+				defer lock.Unlock()
+				if fail {
+					return errors.New("peer not reachable")
+				}
+				return nil
+			},
+		),
+		streamtest.WithBaseAddr(pivotNode),
+	)
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithPeers(peer1, peer2))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err == nil {
+		t.Fatal("expected error")
+	}
+
+	lock.Lock()
+	fail = false
+	lock.Unlock()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := histograms(t, psPivot, "pushsync_peers_tried_per_push")
+	for _, result := range []string{"success", "failure"} {
+		if got := hs[result].GetSampleCount(); got != 1 {
+			t.Fatalf("got %d %s samples, want 1", got, result)
+		}
+	}
+	if got := hs["failure"].GetSampleSum(); got != 2 {
+		t.Fatalf("got %v peers tried for the failed push, want 2", got)
+	}
+}
+
+// TestReceiptRTT checks that the round trip time is recorded only for pushes
+// that receive a receipt.
+func TestReceiptRTT(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	var (
+		lock sync.Mutex
+		fail = true
+	)
+	recorder := streamtest.New(
+		streamtest.WithProtocols(psPeer.Protocol()),
+		streamtest.WithMiddlewares(
+			func(h p2p.HandlerFunc) p2p.HandlerFunc {
+				return func(ctx context.Context, peer p2p.Peer, stream p2p.Stream) error {
+					lock.Lock()
+					failing := fail
+					lock.Unlock()
+					if failing {
+						// the peer reads the delivery without a receipt
+						stream.Close()
+						return errors.New("peer not reachable")
+					}
+					return h(ctx, peer, stream)
+				}
+			},
+		),
+		streamtest.WithBaseAddr(pivotNode),
+	)
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := histograms(t, psPivot, "pushsync_receipt_rtt_seconds")[""].GetSampleCount(); got != 0 {
+		t.Fatalf("got %d round trip times for a failed push, want 0", got)
+	}
+
+	lock.Lock()
+	fail = false
+	lock.Unlock()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+	if got := histograms(t, psPivot, "pushsync_receipt_rtt_seconds")[""].GetSampleCount(); got != 1 {
+		t.Fatalf("got %d round trip times, want 1", got)
+	}
+}
+
+// TestMetricsRecorder checks that the protocol events are recorded with the
+// recorder set with WithMetricsRecorder instead of the default collectors.
+func TestMetricsRecorder(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	peerRecorder := new(countingRecorder)
+	psPeer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithMetricsRecorder(peerRecorder)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	pivotRecorder := new(countingRecorder)
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithMetricsRecorder(pivotRecorder)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := atomic.LoadInt32(&pivotRecorder.sent); got != 1 {
+		t.Errorf("got %d sent chunks, want 1", got)
+	}
+	if got := atomic.LoadInt32(&pivotRecorder.rtt); got != 1 {
+		t.Errorf("got %d observed receipt round trips, want 1", got)
+	}
+	if got := atomic.LoadInt32(&peerRecorder.received); got != 1 {
+		t.Errorf("got %d received chunks, want 1", got)
+	}
+	if got := psPivot.Stats().Sent; got != 0 {
+		t.Errorf("got %d sent chunks in stats, want 0", got)
+	}
+}
+
+// countingRecorder is a pushsync.Recorder that counts the recorded events.
+type countingRecorder struct {
+	sent, received, errors, replicated, rtt int32
+}
+
+func (r *countingRecorder) IncSent()                   { atomic.AddInt32(&r.sent, 1) }
+func (r *countingRecorder) IncReceived()               { atomic.AddInt32(&r.received, 1) }
+func (r *countingRecorder) IncErrors()                 { atomic.AddInt32(&r.errors, 1) }
+func (r *countingRecorder) IncReplicated()             { atomic.AddInt32(&r.replicated, 1) }
+func (r *countingRecorder) ObserveRTT(_ time.Duration) { atomic.AddInt32(&r.rtt, 1) }
+
+// TestReceiptV2 checks that receipts with a nonce are used only when both
+// the sender and the receiver support them, and that the nonce is signed.
+func TestReceiptV2(t *testing.T) {
+	networkID := uint64(1)
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := crypto.NewOverlayAddress(key.PublicKey, networkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name          string
+		senderV2      bool
+		handlerV2     bool
+		wantNonceSize int
+	}{
+		{
+			name:          "v1 sender, v1 handler",
+			wantNonceSize: 0,
+		},
+		{
+			name:          "v1 sender, v1.1 handler",
+			handlerV2:     true,
+			wantNonceSize: 0,
+		},
+		{
+			name:          "v1.1 sender, v1 handler",
+			senderV2:      true,
+			wantNonceSize: 0,
+		},
+		{
+			name:          "v1.1 sender, v1.1 handler",
+			senderV2:      true,
+			handlerV2:     true,
+			wantNonceSize: 32,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, crypto.NewDefaultSigner(key), mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			protocols := []p2p.ProtocolSpec{psPeer.Protocol()}
+			if tc.handlerV2 {
+				protocols = psPeer.Protocols()
+			}
+			recorder := streamtest.New(streamtest.WithProtocols(protocols...), streamtest.WithBaseAddr(pivotNode))
+
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithReceiptV2(tc.senderV2)}, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			receipt, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !chunk.Address().Equal(receipt.Address) {
+				t.Fatal("invalid receipt")
+			}
+			if len(receipt.Nonce) != tc.wantNonceSize {
+				t.Fatalf("got nonce size %d, want %d", len(receipt.Nonce), tc.wantNonceSize)
+			}
+
+			signer, err := pushsync.ValidateReceipt(receipt, networkID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !signer.Equal(overlay) {
+				t.Fatalf("got signer %s, want %s", signer, overlay)
+			}
+			if tc.wantNonceSize == 0 {
+				return
+			}
+
+			// a receipt with another nonce is not signed by the peer
+			receipt.Nonce[0]++
+			if signer, err := pushsync.ValidateReceipt(receipt, networkID); err == nil && signer.Equal(overlay) {
+				t.Fatal("receipt with a changed nonce validated")
+			}
+		})
+	}
+}
+
+// TestMaxOutboundPushes checks that pushes wait for a free slot when the
+// maximum number of outbound pushes is reached.
+func TestMaxOutboundPushes(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	// block the push in progress until the second push times out
+	var (
+		entered = make(chan struct{}, 1)
+		release = make(chan struct{})
+	)
+	selector := peerSelectorFunc(func(swarm.Address, []swarm.Address) (swarm.Address, error) {
+		entered <- struct{}{}
+		<-release
+		return swarm.ZeroAddress, topology.ErrWantSelf
+	})
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, nil, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithPeerSelector(selector), pushsync.WithMaxOutboundPushes(1)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+		errC <- err
+	}()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := psPivot.PushChunkToClosest(ctx, chunk); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := <-errC; !errors.Is(err, topology.ErrWantSelf) {
+		t.Fatalf("got error %v, want %v", err, topology.ErrWantSelf)
+	}
+}
+
+// TestReceiptCache checks that the receipt of a pushed chunk is returned for
+// the following pushes of the chunk until it expires.
+func TestReceiptCache(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	var selected int32
+	selector := peerSelectorFunc(func(swarm.Address, []swarm.Address) (swarm.Address, error) {
+		atomic.AddInt32(&selected, 1)
+		return closestPeer, nil
+	})
+
+	const ttl = 100 * time.Millisecond
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithPeerSelector(selector), pushsync.WithReceiptCache(10, ttl)})
+	defer storerPivot.Close()
+
+	first, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == cached {
+		t.Fatal("cached receipt shared between callers")
+	}
+	if !cached.Address.Equal(first.Address) || !bytes.Equal(cached.Signature, first.Signature) {
+		t.Fatalf("got cached receipt %+v, want %+v", cached, first)
+	}
+	if got := atomic.LoadInt32(&selected); got != 1 {
+		t.Fatalf("got %v peer selections, want 1", got)
+	}
+
+	time.Sleep(2 * ttl)
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&selected); got != 2 {
+		t.Fatalf("got %v peer selections after expiry, want 2", got)
+	}
+}
+
+// TestPushChunkToPeer checks that a chunk is pushed to the given peer even
+// if it is not the closest peer to the chunk.
+func TestPushChunkToPeer(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	targetPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, targetPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, pivotAccounting := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	receipt, err := psPivot.PushChunkToPeer(context.Background(), targetPeer, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chunk.Address().Equal(receipt.Address) {
+		t.Fatalf("got receipt address %s, want %s", receipt.Address, chunk.Address())
+	}
+	if !receipt.Peer.Equal(targetPeer) {
+		t.Fatalf("got receipt peer %s, want %s", receipt.Peer, targetPeer)
+	}
+
+	waitOnRecordAndTest(t, targetPeer, recorder, chunk.Address(), chunk.Data())
+	recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+
+	balance, err := pivotAccounting.Balance(targetPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != -int64(fixedPrice) {
+		t.Fatalf("got balance on pivot %d, want %d", balance, -int64(fixedPrice))
+	}
+}
+
+// TestPushChunkToPeerDisconnected checks that pushes to peers that are not
+// connected anymore are told apart and the peers disconnected if enabled.
+func TestPushChunkToPeerDisconnected(t *testing.T) {
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name           string
+		streamErr      error
+		disconnect     bool
+		wantDisconnect bool
+	}{
+		{
+			name:      "dial failure",
+			streamErr: errors.New("dial failed"),
+		},
+		{
+			name:      "disconnected",
+			streamErr: p2p.ErrPeerNotFound,
+		},
+		{
+			name:           "disconnected and disconnect",
+			streamErr:      p2p.ErrPeerNotFound,
+			disconnect:     true,
+			wantDisconnect: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := logging.New(ioutil.Discard, 0)
+			storer := mocks.NewStorer()
+			defer storer.Close()
+
+			recorder := streamtest.NewRecorderDisconnecter(streamtest.New(
+				streamtest.WithBaseAddr(pivotNode),
+				streamtest.WithStreamError(func(swarm.Address, string, string, string) error {
+					return tc.streamErr
+				}),
+			))
+			validStamp := func(ch swarm.Chunk, stamp []byte) (swarm.Chunk, error) {
+				return ch, nil
+			}
+			ps := pushsync.New(pivotNode, recorder, storer, mock.NewTopologyDriver(), tags.NewTags(statestore.NewStateStore(), logger), true, nil, validStamp, logger, accountingmock.NewAccounting(), pricermock.NewMockService(defaultPrices.price, defaultPrices.peerPrice), defaultSigner, nil, pushsync.WithDisconnectStalePeers(tc.disconnect))
+			defer ps.Close()
+
+			_, err := ps.PushChunkToPeer(context.Background(), peer, chunk)
+			if !errors.Is(err, tc.streamErr) {
+				t.Fatalf("got error %v, want %v", err, tc.streamErr)
+			}
+			if got := recorder.IsDisconnected(peer); got != tc.wantDisconnect {
+				t.Fatalf("got disconnected %v, want %v", got, tc.wantDisconnect)
+			}
+		})
+	}
+}
+
+// TestSlowPushThreshold checks that a warning is logged for pushes to a peer
+// that take longer than the threshold set with WithSlowPushThreshold.
+func TestSlowPushThreshold(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name      string
+		threshold time.Duration
+		wantWarn  bool
+	}{
+		{name: "disabled"},
+		{name: "not exceeded", threshold: time.Minute},
+		{name: "exceeded", threshold: time.Millisecond, wantWarn: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			// opening a stream takes longer than the exceeded threshold
+			openDelay := func(swarm.Address, string, string, string) error {
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			}
+			recorder := streamtest.NewRecorderDisconnecter(streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithStreamError(openDelay)))
+
+			var buf bytes.Buffer
+			logger := logging.New(&buf, logrus.WarnLevel)
+			storer := mocks.NewStorer()
+			defer storer.Close()
+			validStamp := func(ch swarm.Chunk, stamp []byte) (swarm.Chunk, error) {
+				return ch.WithStamp(postage.NewStamp(nil, nil)), nil
+			}
+			ps := pushsync.New(pivotNode, recorder, storer, mock.NewTopologyDriver(mock.WithClosestPeer(closestPeer)), tags.NewTags(statestore.NewStateStore(), logger), true, nil, validStamp, logger, accountingmock.NewAccounting(), pricermock.NewMockService(defaultPrices.price, defaultPrices.peerPrice), defaultSigner, nil, pushsync.WithSlowPushThreshold(tc.threshold))
+			defer ps.Close()
+
+			if _, err := ps.PushChunkToClosest(context.Background(), chunk); err != nil {
+				t.Fatal(err)
+			}
+
+			log := buf.String()
+			if got := strings.Contains(log, "slow push"); got != tc.wantWarn {
+				t.Fatalf("got slow push warning %v, want %v", got, tc.wantWarn)
+			}
+			if tc.wantWarn && !strings.Contains(log, closestPeer.String()) {
+				t.Fatalf("slow push warning %q does not name the peer", log)
+			}
+		})
+	}
+}
+
+// TestDeliveryAck checks that failed pushes tell deliveries that did not
+// reach the peer apart from deliveries without a receipt.
+func TestDeliveryAck(t *testing.T) {
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	failingSigner := cryptomock.New(cryptomock.WithSignFunc(func([]byte) ([]byte, error) {
+		return nil, errors.New("sign failed")
+	}))
+	resetStream := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+		return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+			return s.Reset()
+		}
+	}
+	withoutAck := func(spec p2p.ProtocolSpec) p2p.ProtocolSpec {
+		for i := range spec.StreamSpecs {
+			spec.StreamSpecs[i].Headler = nil
+		}
+		return spec
+	}
+
+	for _, tc := range []struct {
+		name        string
+		signer      crypto.Signer
+		middlewares []p2p.HandlerMiddleware
+		noAck       bool
+		wantErr     error
+	}{
+		{
+			name:   "receipt",
+			signer: defaultSigner,
+		},
+		{
+			name:   "peer without ack",
+			signer: defaultSigner,
+			noAck:  true,
+		},
+		{
+			name:    "delivered without receipt",
+			signer:  failingSigner,
+			wantErr: pushsync.ErrDeliveredNoReceipt,
+		},
+		{
+			name:        "not delivered",
+			signer:      defaultSigner,
+			middlewares: []p2p.HandlerMiddleware{resetStream},
+			wantErr:     pushsync.ErrNotDelivered,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, peer, defaultPrices, nil, nil, tc.signer, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			spec := psPeer.Protocol()
+			if tc.noAck {
+				spec = withoutAck(spec)
+			}
+			recorder := streamtest.New(streamtest.WithProtocols(spec), streamtest.WithBaseAddr(pivotNode), streamtest.WithMiddlewares(tc.middlewares...))
+
+			psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithDeliveryAck(true)})
+			defer storerPivot.Close()
+
+			_, err := psPivot.PushChunkToPeer(context.Background(), peer, chunk)
+			if tc.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestPushChunkToPeerReserveError checks that a failure to reserve the price
+// of the receipt is returned with the address of the peer.
+func TestPushChunkToPeerReserveError(t *testing.T) {
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	targetPeer := swarm.MustParseHexAddress("4000000000000000000000000000000000000000000000000000000000000000")
+
+	errReserve := errors.New("unable to reserve")
+	pivotAccounting := accountingmock.NewAccounting(
+		accountingmock.WithReserveFunc(func(context.Context, swarm.Address, uint64) error {
+			return errReserve
+		}),
+	)
+
+	recorder := streamtest.New(streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithAccounting(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, pivotAccounting)
+	defer storerPivot.Close()
+
+	_, err := psPivot.PushChunkToPeer(context.Background(), targetPeer, chunk)
+	if !errors.Is(err, errReserve) {
+		t.Fatalf("got error %v, want %v", err, errReserve)
+	}
+	if !strings.Contains(err.Error(), targetPeer.String()) {
+		t.Fatalf("error %q does not contain peer %s", err, targetPeer)
+	}
+}
+
+// TestAccountingDisabled checks that the prices of receipts are neither
+// reserved nor credited and debited when accounting is disabled.
+func TestAccountingDisabled(t *testing.T) {
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	peerAccounting := accountingmock.NewAccounting()
+	psPeer, storerPeer, _ := createPushSyncNodeWithOptions(t, closestPeer, defaultPrices, nil, nil, defaultSigner, peerAccounting, []pushsync.Option{pushsync.WithAccountingDisabled(true)}, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	pivotAccounting := accountingmock.NewAccounting(
+		accountingmock.WithReserveFunc(func(context.Context, swarm.Address, uint64) error {
+			return errors.New("unable to reserve")
+		}),
+	)
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, pivotAccounting, []pushsync.Option{pushsync.WithAccountingDisabled(true)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	balance, err := pivotAccounting.Balance(closestPeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != 0 {
+		t.Fatalf("got pivot balance %d, want 0", balance)
+	}
+	balance, err = peerAccounting.Balance(pivotNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != 0 {
+		t.Fatalf("got peer balance %d, want 0", balance)
+	}
+}
+
+// TestStreamCachingPushSync checks that chunks pushed to the same peer are
+// delivered over a single stream.
+func TestStreamCachingPushSync(t *testing.T) {
+	chunks := []swarm.Chunk{
+		testingc.FixtureChunk("7000"),
+		testingc.FixtureChunk("0033"),
+		testingc.FixtureChunk("02c2"),
+	}
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	pusher := pushsync.NewStreamCachingPushSync(psPivot, 1)
+
+	for _, ch := range chunks {
+		receipt, err := pusher.PushChunkToClosest(context.Background(), ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ch.Address().Equal(receipt.Address) {
+			t.Fatalf("got receipt address %s, want %s", receipt.Address, ch.Address())
+		}
+	}
+
+	if err := pusher.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.BatchStreamName, 1, 5)
+	messages, err := protobuf.ReadMessages(bytes.NewReader(records[0].In()), func() protobuf.Message { return new(pb.Delivery) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != len(chunks) {
+		t.Fatalf("got %d deliveries over the stream, want %d", len(messages), len(chunks))
+	}
+	recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 0, 1)
+}
+
+// TestStreamCachingPushSyncFailure checks that a failed push over a cached
+// stream is recorded against the peer like a failed push over a new stream.
+func TestStreamCachingPushSyncFailure(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	// the peer does not accept batch streams
+	batchStreamErr := func(_ swarm.Address, _, _, streamName string) error {
+		if streamName == pushsync.BatchStreamName {
+			return errors.New("batch stream refused")
+		}
+		return nil
+	}
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithStreamError(batchStreamErr))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	pusher := pushsync.NewStreamCachingPushSync(psPivot, 1)
+	defer pusher.Close()
+
+	// the chunk is pushed over a new stream instead
+	if _, err := pusher.PushChunkToClosest(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := metricValue(t, psPivot, "pushsync_total_failed_send_attempts"); got != 1 {
+		t.Fatalf("got %v failed send attempts, want 1", got)
+	}
+}
+
+// TestStreamCachingPushSyncClosedStream checks that a cached stream closed by
+// the peer while it was idle is replaced without penalizing the peer.
+func TestStreamCachingPushSyncClosedStream(t *testing.T) {
+	chunks := []swarm.Chunk{
+		testingc.FixtureChunk("7000"),
+		testingc.FixtureChunk("0033"),
+	}
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	// the peer closes the first stream after its first receipt
+	var streams int32
+	closeFirst := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+		return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+			if atomic.AddInt32(&streams, 1) == 1 {
+				s = &resetAfterWriteStream{Stream: s}
+			}
+			return h(ctx, p, s)
+		}
+	}
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithMiddlewares(closeFirst))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	pusher := pushsync.NewStreamCachingPushSync(psPivot, 1)
+	defer pusher.Close()
+
+	for _, ch := range chunks {
+		if _, err := pusher.PushChunkToClosest(context.Background(), ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := metricValue(t, psPivot, "pushsync_total_failed_send_attempts"); got != 0 {
+		t.Fatalf("got %v failed send attempts, want 0", got)
+	}
+	recorder.WaitRecords(t, closestPeer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.BatchStreamName, 2, 5)
+}
+
+// resetAfterWriteStream is a stream that is reset after the first write.
+type resetAfterWriteStream struct {
+	p2p.Stream
+}
+
+func (s *resetAfterWriteStream) Write(p []byte) (int, error) {
+	n, err := s.Stream.Write(p)
+	_ = s.Stream.Reset()
+	return n, err
+}
+
+// TestClock checks that the request timeout of a push is driven by the clock
+// of PushSync.
+func TestClock(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	// block the closest peer until the push has timed out
+	release := make(chan struct{})
+	defer close(release)
+	blockHandler := func(h p2p.HandlerFunc) p2p.HandlerFunc {
+		return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+			<-release
+			return h(ctx, p, s)
+		}
+	}
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithMiddlewares(blockHandler))
+
+	clock := &fakeClock{afterC: make(chan time.Time)}
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithClock(clock), pushsync.WithMaxPeers(1)}, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+		errC <- err
+	}()
+
+	select {
+	case clock.afterC <- time.Now():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the push to wait on the clock")
+	}
+
+	select {
+	case err := <-errC:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the push to time out")
+	}
+}
+
+// fakeClock is a pushsync.Clock whose timers fire when a time is sent on
+// afterC.
+type fakeClock struct {
+	afterC chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time                       { return time.Now() }
+func (c *fakeClock) After(time.Duration) <-chan time.Time { return c.afterC }
+
+// pushAllocsBudget is the maximum number of allocations a successful push
+// over a new stream is allowed to make, including the ones of the receiving
+// peer. Lower it together with changes that reduce the allocations of the
+// happy path.
+const pushAllocsBudget = 1000
+
+// TestPushAllocations guards the allocations of the happy path of
+// PushChunkToClosest.
+func TestPushAllocations(t *testing.T) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode))
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > pushAllocsBudget {
+		t.Fatalf("got %v allocations per push, want at most %v", allocs, pushAllocsBudget)
+	}
+}
+
+// BenchmarkPushSequential compares the latency of sequential pushes to the
+// same peer over new streams and over a cached stream, with and without a
+// delay for opening a stream, as it takes to negotiate a stream with a remote
+// peer.
+func BenchmarkPushSequential(b *testing.B) {
+	// chunk data to upload
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, bc := range []struct {
+		name      string
+		newPusher func(*pushsync.PushSync) pushsync.PushSyncer
+		openDelay time.Duration
+	}{
+		{
+			name:      "new stream",
+			newPusher: func(ps *pushsync.PushSync) pushsync.PushSyncer { return ps },
+		},
+		{
+			name: "cached stream",
+			newPusher: func(ps *pushsync.PushSync) pushsync.PushSyncer {
+				return pushsync.NewStreamCachingPushSync(ps, 1)
+			},
+		},
+		{
+			name:      "new stream with open delay",
+			newPusher: func(ps *pushsync.PushSync) pushsync.PushSyncer { return ps },
+			openDelay: time.Millisecond,
+		},
+		{
+			name: "cached stream with open delay",
+			newPusher: func(ps *pushsync.PushSync) pushsync.PushSyncer {
+				return pushsync.NewStreamCachingPushSync(ps, 1)
+			},
+			openDelay: time.Millisecond,
+		},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(b, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			openDelay := func(swarm.Address, string, string, string) error {
+				time.Sleep(bc.openDelay)
+				return nil
+			}
+			recorder := streamtest.New(streamtest.WithProtocols(psPeer.Protocol()), streamtest.WithBaseAddr(pivotNode), streamtest.WithStreamError(openDelay))
+
+			psPivot, storerPivot, _, _ := createPushSyncNode(b, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			pusher := bc.newPusher(psPivot)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := pusher.PushChunkToClosest(context.Background(), chunk); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func createPushSyncNode(t testing.TB, addr swarm.Address, prices pricerParameters, recorder *streamtest.Recorder, unwrap func(swarm.Chunk), signer crypto.Signer, mockOpts ...mock.Option) (*pushsync.PushSync, *mocks.MockStorer, *tags.Tags, accounting.Interface) {
+	t.Helper()
+	mockAccounting := accountingmock.NewAccounting()
+	ps, mstorer, ts := createPushSyncNodeWithAccounting(t, addr, prices, recorder, unwrap, signer, mockAccounting, mockOpts...)
+	return ps, mstorer, ts, mockAccounting
+}
+
+func createPushSyncNodeWithAccounting(t testing.TB, addr swarm.Address, prices pricerParameters, recorder *streamtest.Recorder, unwrap func(swarm.Chunk), signer crypto.Signer, acct accounting.Interface, mockOpts ...mock.Option) (*pushsync.PushSync, *mocks.MockStorer, *tags.Tags) {
+	t.Helper()
+	return createPushSyncNodeWithOptions(t, addr, prices, recorder, unwrap, signer, acct, nil, mockOpts...)
+}
+
+func createPushSyncNodeWithOptions(t testing.TB, addr swarm.Address, prices pricerParameters, recorder *streamtest.Recorder, unwrap func(swarm.Chunk), signer crypto.Signer, acct accounting.Interface, psOpts []pushsync.Option, mockOpts ...mock.Option) (*pushsync.PushSync, *mocks.MockStorer, *tags.Tags) {
+	t.Helper()
+	logger := logging.New(ioutil.Discard, 0)
+	storer := mocks.NewStorer()
+
+	mockTopology := mock.NewTopologyDriver(mockOpts...)
+	mockStatestore := statestore.NewStateStore()
+	mtag := tags.NewTags(mockStatestore, logger)
+
+	mockPricer := pricermock.NewMockService(prices.price, prices.peerPrice)
+
+	recorderDisconnecter := streamtest.NewRecorderDisconnecter(recorder)
+	if unwrap == nil {
+		unwrap = func(swarm.Chunk) {}
+	}
+	validStamp := func(ch swarm.Chunk, stamp []byte) (swarm.Chunk, error) {
+		return ch.WithStamp(postage.NewStamp(nil, nil)), nil
+	}
+
+	return pushsync.New(addr, recorderDisconnecter, storer, mockTopology, mtag, true, unwrap, validStamp, logger, acct, mockPricer, signer, nil, psOpts...), storer, mtag
+}
+
+func waitOnRecordAndTest(t *testing.T, peer swarm.Address, recorder *streamtest.Recorder, add swarm.Address, data []byte) {
+	t.Helper()
+	records := recorder.WaitRecords(t, peer, pushsync.ProtocolName, pushsync.ProtocolVersion, pushsync.StreamName, 1, 5)
+
+	if data != nil {
+		messages, err := protobuf.ReadMessages(
+			bytes.NewReader(records[0].In()),
+			func() protobuf.Message { return new(pb.Delivery) },
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messages == nil {
+			t.Fatal("nil rcvd. for message")
+		}
+		if len(messages) > 1 {
+			t.Fatal("too many messages")
+		}
+		delivery := messages[0].(*pb.Delivery)
+
+		if !bytes.Equal(delivery.Address, add.Bytes()) {
+			t.Fatalf("chunk address mismatch")
+		}
+
+		if !bytes.Equal(delivery.Data, data) {
+			t.Fatalf("chunk data mismatch")
+		}
+	} else {
+		messages, err := protobuf.ReadMessages(
+			bytes.NewReader(records[0].In()),
+			func() protobuf.Message { return new(pb.Receipt) },
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messages == nil {
+			t.Fatal("nil rcvd. for message")
+		}
+		if len(messages) > 1 {
+			t.Fatal("too many messages")
+		}
+		receipt := messages[0].(*pb.Receipt)
+		receiptAddress := swarm.NewAddress(receipt.Address)
+
+		if !receiptAddress.Equal(add) {
+			t.Fatalf("receipt address mismatch")
+		}
+	}
+}
+
+func TestFailureRequestCache(t *testing.T) {
 	cache := pushsync.FailedRequestCache()
 	peer := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
 	chunk := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
@@ -909,6 +4581,281 @@ func TestFailureRequestCache(t *testing.T) {
 	})
 }
 
+func TestPeerCircuitBreaker(t *testing.T) {
+	breaker := pushsync.PeerCircuitBreaker(2, 100*time.Millisecond)
+	peer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	now := time.Now()
+
+	t.Run("open after max failures", func(t *testing.T) {
+		breaker.RecordFailure(peer, now)
+		if l := len(breaker.OpenPeers(now)); l != 0 {
+			t.Fatalf("got %d open peers after 1st failure, want 0", l)
+		}
+
+		breaker.RecordFailure(peer, now)
+		open := breaker.OpenPeers(now)
+		if len(open) != 1 || !open[0].Equal(peer) {
+			t.Fatalf("got open peers %v, want %v", open, peer)
+		}
+	})
+
+	t.Run("closed after cooldown", func(t *testing.T) {
+		if l := len(breaker.OpenPeers(now.Add(150 * time.Millisecond))); l != 0 {
+			t.Fatalf("got %d open peers after cooldown, want 0", l)
+		}
+	})
+
+	t.Run("reset after success", func(t *testing.T) {
+		breaker.RecordFailure(peer, now)
+		breaker.RecordSuccess(peer)
+		breaker.RecordFailure(peer, now)
+		if l := len(breaker.OpenPeers(now)); l != 0 {
+			t.Fatalf("got %d open peers after intermittent success, want 0", l)
+		}
+	})
+}
+
+func TestPeerPriceCache(t *testing.T) {
+	cache := pushsync.PeerPriceCache(100 * time.Millisecond)
+	peer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	now := time.Now()
+
+	t.Run("cached price", func(t *testing.T) {
+		if _, ok := cache.Get(peer, 1, now); ok {
+			t.Fatal("got price from empty cache")
+		}
+
+		cache.Set(peer, 1, 10, now)
+		if price, ok := cache.Get(peer, 1, now); !ok || price != 10 {
+			t.Fatalf("got price %d (found %v), want 10", price, ok)
+		}
+		if _, ok := cache.Get(peer, 2, now); ok {
+			t.Fatal("got price for other proximity order")
+		}
+	})
+
+	t.Run("invalidated", func(t *testing.T) {
+		cache.Invalidate(peer)
+		if _, ok := cache.Get(peer, 1, now); ok {
+			t.Fatal("got price after invalidation")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		cache.Set(peer, 1, 10, now)
+		if _, ok := cache.Get(peer, 1, now.Add(150*time.Millisecond)); ok {
+			t.Fatal("got expired price")
+		}
+	})
+}
+
+// TestCancel checks that a push in flight is cancelled by the address of its
+// chunk.
+func TestCancel(t *testing.T) {
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+	defer storerPeer.Close()
+
+	var (
+		inFlight = make(chan struct{})
+		release  = make(chan struct{})
+	)
+	defer close(release)
+
+	// the peer does not respond until released
+	recorder := streamtest.New(
+		streamtest.WithProtocols(psPeer.Protocol()),
+		streamtest.WithBaseAddr(pivotNode),
+		streamtest.WithMiddlewares(func(h p2p.HandlerFunc) p2p.HandlerFunc {
+			return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+				close(inFlight)
+				<-release
+				return h(ctx, p, s)
+			}
+		}),
+	)
+
+	psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+	defer storerPivot.Close()
+
+	// cancelling without a push in flight is a no-op
+	psPivot.Cancel(chunk.Address())
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := psPivot.PushChunkToClosest(context.Background(), chunk)
+		errC <- err
+	}()
+
+	select {
+	case <-inFlight:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for push")
+	}
+
+	psPivot.Cancel(chunk.Address())
+
+	select {
+	case err := <-errC:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("push not cancelled")
+	}
+}
+
+// TestPushChunkToClosestContextErrors checks that pushes stopped by their
+// context return errors that tell timeouts and cancellations apart from
+// failed pushes.
+func TestPushChunkToClosestContextErrors(t *testing.T) {
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	closestPeer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	for _, tc := range []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+		ctxErr  error
+	}{
+		{
+			name: "timeout",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			wantErr: pushsync.ErrPushTimeout,
+			ctxErr:  context.DeadlineExceeded,
+		},
+		{
+			name: "canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(100*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			wantErr: pushsync.ErrPushCanceled,
+			ctxErr:  context.Canceled,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			psPeer, storerPeer, _, _ := createPushSyncNode(t, closestPeer, defaultPrices, nil, nil, defaultSigner, mock.WithClosestPeerErr(topology.ErrWantSelf))
+			defer storerPeer.Close()
+
+			release := make(chan struct{})
+			defer close(release)
+
+			// the peer does not respond until released
+			recorder := streamtest.New(
+				streamtest.WithProtocols(psPeer.Protocol()),
+				streamtest.WithBaseAddr(pivotNode),
+				streamtest.WithMiddlewares(func(h p2p.HandlerFunc) p2p.HandlerFunc {
+					return func(ctx context.Context, p p2p.Peer, s p2p.Stream) error {
+						<-release
+						return h(ctx, p, s)
+					}
+				}),
+			)
+
+			psPivot, storerPivot, _, _ := createPushSyncNode(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, mock.WithClosestPeer(closestPeer))
+			defer storerPivot.Close()
+
+			ctx, cancel := tc.ctx()
+			defer cancel()
+
+			_, err := psPivot.PushChunkToClosest(ctx, chunk)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if !errors.Is(err, tc.ctxErr) {
+				t.Fatalf("got error %v, want %v", err, tc.ctxErr)
+			}
+			if errors.Is(err, pushsync.ErrNoReceipt) {
+				t.Fatalf("got error %v, want no %v", err, pushsync.ErrNoReceipt)
+			}
+		})
+	}
+}
+
+func TestRecentFailures(t *testing.T) {
+	failures := pushsync.RecentFailures(time.Minute)
+	chunk := swarm.MustParseHexAddress("7000000000000000000000000000000000000000000000000000000000000000")
+	otherChunk := swarm.MustParseHexAddress("8000000000000000000000000000000000000000000000000000000000000000")
+	peer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+	now := time.Now()
+
+	failures.Add(chunk, peer, now)
+
+	if peers := failures.Peers(chunk, now.Add(time.Second)); len(peers) != 1 || !peers[0].Equal(peer) {
+		t.Fatalf("got peers %v, want %s", peers, peer)
+	}
+	if peers := failures.Peers(otherChunk, now.Add(time.Second)); len(peers) != 0 {
+		t.Fatalf("got peers %v for other chunk", peers)
+	}
+	if peers := failures.Peers(chunk, now.Add(time.Minute)); len(peers) != 0 {
+		t.Fatalf("got expired peers %v", peers)
+	}
+}
+
+// TestPushChunkToClosestFailureMemory checks that a peer that failed to push
+// a chunk is skipped when the chunk is pushed again.
+func TestPushChunkToClosestFailureMemory(t *testing.T) {
+	chunk := testingc.FixtureChunk("7000")
+
+	pivotNode := swarm.MustParseHexAddress("0000000000000000000000000000000000000000000000000000000000000000")
+	peer := swarm.MustParseHexAddress("6000000000000000000000000000000000000000000000000000000000000000")
+
+	var (
+		mtx   sync.Mutex
+		skips [][]swarm.Address
+	)
+	selector := peerSelectorFunc(func(addr swarm.Address, skip []swarm.Address) (swarm.Address, error) {
+		mtx.Lock()
+		skips = append(skips, append([]swarm.Address(nil), skip...))
+		mtx.Unlock()
+		for _, s := range skip {
+			if s.Equal(peer) {
+				return swarm.ZeroAddress, topology.ErrNotFound
+			}
+		}
+		return peer, nil
+	})
+
+	// the peer is unreachable
+	recorder := streamtest.New(
+		streamtest.WithBaseAddr(pivotNode),
+		streamtest.WithStreamError(func(swarm.Address, string, string, string) error {
+			return errors.New("peer unavailable")
+		}),
+	)
+
+	psPivot, storerPivot, _ := createPushSyncNodeWithOptions(t, pivotNode, defaultPrices, recorder, nil, defaultSigner, accountingmock.NewAccounting(), []pushsync.Option{pushsync.WithPeerSelector(selector), pushsync.WithFailureMemory(time.Minute)})
+	defer storerPivot.Close()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); !errors.Is(err, pushsync.ErrNoReceipt) {
+		t.Fatalf("got error %v, want %v", err, pushsync.ErrNoReceipt)
+	}
+
+	mtx.Lock()
+	skips = nil
+	mtx.Unlock()
+
+	if _, err := psPivot.PushChunkToClosest(context.Background(), chunk); err == nil {
+		t.Fatal("expected error pushing to remembered peer")
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(skips) == 0 || len(skips[0]) != 1 || !skips[0][0].Equal(peer) {
+		t.Fatalf("got skipped peers %v, want %s", skips, peer)
+	}
+}
+
 func TestPushChunkToClosestSkipFailed(t *testing.T) {
 
 	// chunk data to upload
@@ -0,0 +1,245 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/postage"
+	"github.com/ethersphere/bee/pkg/storage"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+const (
+	defaultQueuedPutTimeout = 30 * time.Second // time to store a chunk from the put queue
+	queuedPutRetryDelay     = time.Second      // time to wait before a failed put from the queue is retried
+	maxQueuedPutAttempts    = 3                // number of puts of a chunk from the queue before it is left in the log
+)
+
+// WriteAheadLog durably records the chunks that are queued to be stored, so
+// that they are not lost if the node stops before they are stored.
+type WriteAheadLog interface {
+	// Append records the chunk. It returns once the record is durable.
+	Append(ch swarm.Chunk) error
+	// Remove removes the record of the chunk once it is stored.
+	Remove(addr swarm.Address) error
+	// Iterate calls fn with the recorded chunks until it returns true or an
+	// error. The log must not be changed by fn.
+	Iterate(fn func(ch swarm.Chunk) (stop bool, err error)) error
+}
+
+const stateStoreWALKeyPrefix = "pushsync_wal_"
+
+// StateStoreWAL is a WriteAheadLog that records the chunks in a state store.
+type StateStoreWAL struct {
+	store storage.StateStorer
+}
+
+// NewStateStoreWAL returns a WriteAheadLog that records the chunks in the
+// state store.
+func NewStateStoreWAL(store storage.StateStorer) *StateStoreWAL {
+	return &StateStoreWAL{store: store}
+}
+
+// walRecord is the record of a chunk in the state store.
+type walRecord struct {
+	Address []byte `json:"address"`
+	Data    []byte `json:"data"`
+	Stamp   []byte `json:"stamp"`
+}
+
+func stateStoreWALKey(addr swarm.Address) string {
+	return stateStoreWALKeyPrefix + addr.String()
+}
+
+// Append implements WriteAheadLog.
+func (l *StateStoreWAL) Append(ch swarm.Chunk) error {
+	stamp, err := ch.Stamp().MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshal stamp: %w", err)
+	}
+	return l.store.Put(stateStoreWALKey(ch.Address()), &walRecord{
+		Address: ch.Address().Bytes(),
+		Data:    ch.Data(),
+		Stamp:   stamp,
+	})
+}
+
+// Remove implements WriteAheadLog.
+func (l *StateStoreWAL) Remove(addr swarm.Address) error {
+	return l.store.Delete(stateStoreWALKey(addr))
+}
+
+// Iterate implements WriteAheadLog.
+func (l *StateStoreWAL) Iterate(fn func(ch swarm.Chunk) (stop bool, err error)) error {
+	return l.store.Iterate(stateStoreWALKeyPrefix, func(_, value []byte) (bool, error) {
+		var r walRecord
+		if err := json.Unmarshal(value, &r); err != nil {
+			return true, fmt.Errorf("unmarshal record: %w", err)
+		}
+		stamp := new(postage.Stamp)
+		if err := stamp.UnmarshalBinary(r.Stamp); err != nil {
+			return true, fmt.Errorf("unmarshal stamp: %w", err)
+		}
+		return fn(swarm.NewChunk(swarm.NewAddress(r.Address), r.Data).WithStamp(stamp))
+	})
+}
+
+// WithStorePutQueue stores the chunks that this node returns receipts for
+// in the background, through a queue of the given depth, instead of before
+// the receipt is returned. Chunks are recorded in the write-ahead log set
+// with WithWriteAheadLog before they are queued, so the queue is only used if
+// the log is set. Deliveries wait while the queue is full. Failed puts from
+// the queue are retried, and the queued chunks are stored when PushSync is
+// closed. The records of chunks that are not removed from the log were not
+// stored, and are queued again when PushSync is created. Values lower than 1
+// keep storing synchronously.
+func WithStorePutQueue(depth int) Option {
+	return func(ps *PushSync) {
+		ps.putQueueDepth = depth
+	}
+}
+
+// WithStorePutTimeout sets the time within which a chunk from the queue set
+// with WithStorePutQueue must be stored, before the put is retried. Values
+// lower than or equal to 0 are ignored.
+func WithStorePutTimeout(d time.Duration) Option {
+	return func(ps *PushSync) {
+		if d <= 0 {
+			return
+		}
+		ps.queuedPutTimeout = d
+	}
+}
+
+// WithWriteAheadLog sets the write-ahead log of the chunks in the queue set
+// with WithStorePutQueue.
+func WithWriteAheadLog(l WriteAheadLog) Option {
+	return func(ps *PushSync) {
+		ps.wal = l
+	}
+}
+
+// put stores the chunk, either directly or through the put queue. Chunks are
+// not queued anymore once the queue is drained on close.
+func (ps *PushSync) put(ctx context.Context, ch swarm.Chunk) error {
+	if ps.putQueue == nil {
+		_, err := ps.storer.Put(ctx, storage.ModePutSync, ch)
+		return err
+	}
+
+	ps.putQueueMu.RLock()
+	defer ps.putQueueMu.RUnlock()
+
+	if ps.putQueueClosed {
+		return ErrClosed
+	}
+	if err := ps.wal.Append(ch); err != nil {
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+
+	var err error
+	select {
+	case ps.putQueue <- ch:
+		return nil
+	case <-ps.quit:
+		err = ErrClosed
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err := ps.wal.Remove(ch.Address()); err != nil {
+		ps.logger.Debugf("pushsync: remove chunk %s from write-ahead log: %v", ch.Address(), err)
+	}
+	return err
+}
+
+// startPutQueue starts storing the chunks of the put queue until PushSync is
+// closed, after which the chunks left in the queue are stored. The chunks left
+// in the write-ahead log are stored first.
+func (ps *PushSync) startPutQueue() {
+	ps.putQueue = make(chan swarm.Chunk, ps.putQueueDepth)
+	ps.wg.Add(1)
+	go func() {
+		defer ps.wg.Done()
+		for _, ch := range ps.loggedChunks() {
+			ps.storeQueued(ch)
+		}
+		for {
+			select {
+			case ch := <-ps.putQueue:
+				ps.storeQueued(ch)
+			case <-ps.quit:
+				// wait for the puts that are enqueueing and refuse new ones,
+				// so that no chunk is queued after the queue is drained
+				ps.putQueueMu.Lock()
+				ps.putQueueClosed = true
+				ps.putQueueMu.Unlock()
+				for {
+					select {
+					case ch := <-ps.putQueue:
+						ps.storeQueued(ch)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// loggedChunks returns the chunks left in the write-ahead log. They are
+// collected before they are stored, as the log must not be changed while it
+// is iterated.
+func (ps *PushSync) loggedChunks() []swarm.Chunk {
+	var chunks []swarm.Chunk
+	err := ps.wal.Iterate(func(ch swarm.Chunk) (bool, error) {
+		chunks = append(chunks, ch)
+		return false, nil
+	})
+	if err != nil {
+		ps.logger.Errorf("pushsync: read write-ahead log: %v", err)
+	}
+	return chunks
+}
+
+// storeQueued stores the chunk from the put queue and removes its record
+// from the write-ahead log. Failed puts are retried, and chunks that could not
+// be stored are left in the log.
+func (ps *PushSync) storeQueued(ch swarm.Chunk) {
+	for attempt := 1; ; attempt++ {
+		err := ps.putQueued(ch)
+		if err == nil {
+			break
+		}
+		ps.metrics.TotalQueuedPutErrors.Inc()
+		if attempt == maxQueuedPutAttempts {
+			ps.logger.Errorf("pushsync: store queued chunk %s, left in write-ahead log: %v", ch.Address(), err)
+			return
+		}
+		ps.logger.Debugf("pushsync: store queued chunk %s, attempt %d: %v", ch.Address(), attempt, err)
+
+		// the queue is flushed without delays once PushSync is closed
+		select {
+		case <-ps.clock.After(queuedPutRetryDelay):
+		case <-ps.quit:
+		}
+	}
+
+	if err := ps.wal.Remove(ch.Address()); err != nil {
+		ps.logger.Debugf("pushsync: remove chunk %s from write-ahead log: %v", ch.Address(), err)
+	}
+}
+
+// putQueued stores the chunk from the put queue within the put timeout.
+func (ps *PushSync) putQueued(ch swarm.Chunk) error {
+	ctx, cancel := ps.withTimeout(context.Background(), ps.queuedPutTimeout)
+	defer cancel()
+
+	_, err := ps.storer.Put(ctx, storage.ModePutSync, ch)
+	return err
+}
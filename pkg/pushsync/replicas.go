@@ -0,0 +1,105 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+	"github.com/ethersphere/bee/pkg/p2p/protobuf"
+	"github.com/ethersphere/bee/pkg/pushsync/pb"
+)
+
+// WithSynchronousReplication makes the node that stores a chunk as the closest
+// to it wait for at least minReplicas neighbors to store the chunk before it
+// returns the receipt. The wait is bounded by the neighbor push timeout, after
+// which the receipt is returned anyway with the number of missing replicas in
+// Receipt.MissingReplicas, and the timeout is counted in the metrics. Values
+// lower than 1 keep the replication asynchronous.
+func WithSynchronousReplication(minReplicas int) Option {
+	return func(ps *PushSync) {
+		ps.minReplicas = minReplicas
+	}
+}
+
+// replicaReceiptsHeader is the name of the stream header with which the
+// sender of a delivery asks for the receipt to be returned as a
+// pb.ReceiptBundle with the signatures of the neighbors that the storer
+// replicated the chunk to. Peers that do not know the header return a plain
+// receipt, which decodes as a bundle without replica signatures.
+const replicaReceiptsHeader = "replica-receipts"
+
+type replicaReceiptsKey struct{}
+
+// withReplicaReceipts returns a copy of ctx that records whether the sender
+// of the delivery handled within it asked for replica receipts in headers.
+func withReplicaReceipts(ctx context.Context, headers p2p.Headers) context.Context {
+	if _, ok := headers[replicaReceiptsHeader]; !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, replicaReceiptsKey{}, true)
+}
+
+// wantsReplicaReceipts reports whether the sender of the delivery handled
+// within ctx asked for replica receipts.
+func wantsReplicaReceipts(ctx context.Context) bool {
+	want, _ := ctx.Value(replicaReceiptsKey{}).(bool)
+	return want
+}
+
+// requestReplicaReceipts reports whether a push made within ctx asks the
+// peer for replica receipts, either because it is enabled on this node or
+// because the sender of the forwarded delivery asked for them.
+func (ps *PushSync) requestReplicaReceipts(ctx context.Context) bool {
+	return ps.replicaReceipts || wantsReplicaReceipts(ctx)
+}
+
+// waitMinReplicas waits until the minimum number of replicas is signalled on
+// stored, until all replications are done, or until the neighbor push
+// timeout. It returns the number of replicas that the minimum is short of.
+func (ps *PushSync) waitMinReplicas(ctx context.Context, stored, done <-chan struct{}) int {
+	timeout := ps.clock.After(ps.neighborPushTimeout)
+	for n := 0; n < ps.minReplicas; n++ {
+		select {
+		case <-stored:
+		case <-done:
+			// replicas that stored the chunk are signalled before they are done
+			if missing := ps.minReplicas - n - len(stored); missing > 0 {
+				return missing
+			}
+			return 0
+		case <-timeout:
+			return ps.minReplicas - n
+		case <-ctx.Done():
+			return ps.minReplicas - n
+		}
+	}
+	return 0
+}
+
+// makePushHeaders returns the headers of a stream that pushes a chunk within
+// ctx.
+func (ps *PushSync) makePushHeaders(ctx context.Context) p2p.Headers {
+	headers := makeHopsHeaders(ctx)
+	if ps.requestReplicaReceipts(ctx) {
+		headers[replicaReceiptsHeader] = []byte{1}
+	}
+	return headers
+}
+
+// writeDeliveryReceipt writes back the receipt for the delivery handled
+// within ctx. It is written with the inclusion proof p if the sender asked
+// for it, as a bundle if the sender asked for the replica signatures or if
+// replicas are missing, or in the format of the protocol version otherwise.
+// Senders that do not know the bundle decode it as a plain receipt.
+func writeDeliveryReceipt(ctx context.Context, w protobuf.Writer, version string, r *pb.ReceiptBundle, p *InclusionProof) error {
+	if wantsInclusionProof(ctx) {
+		return writeReceiptWithProof(ctx, w, r, p)
+	}
+	if !wantsReplicaReceipts(ctx) && r.MissingReplicas == 0 {
+		return writeReceipt(ctx, w, version, r.Address, r.Signature, r.Nonce)
+	}
+	return w.WriteMsgWithContext(ctx, r)
+}
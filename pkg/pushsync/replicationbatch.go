@@ -0,0 +1,116 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// replicationBatcher coalesces the replications of chunks to the same
+// neighbor that are queued within a time window, and delivers them over a
+// single batch stream once the window has passed.
+type replicationBatcher struct {
+	ps     *PushSync
+	window time.Duration
+	mtx    sync.Mutex
+	queues map[string][]*replication // peer address byte string -> queued replications
+	closed bool
+}
+
+// replication is a chunk queued for replication to a neighbor. Its done
+// function is called with the result of the delivery.
+type replication struct {
+	chunk swarm.Chunk
+	done  func(err error)
+}
+
+func newReplicationBatcher(ps *PushSync, window time.Duration) *replicationBatcher {
+	return &replicationBatcher{
+		ps:     ps,
+		window: window,
+		queues: make(map[string][]*replication),
+	}
+}
+
+// Add queues the replication of the chunk to the peer. The first
+// replication queued for a peer starts its window. It returns ErrClosed,
+// without queueing the replication, once the batcher is closed.
+func (b *replicationBatcher) Add(peer swarm.Address, ch swarm.Chunk, done func(err error)) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	key := peer.ByteString()
+	queue, ok := b.queues[key]
+	b.queues[key] = append(queue, &replication{chunk: ch, done: done})
+	if ok {
+		return nil
+	}
+
+	b.ps.wg.Add(1)
+	go func() {
+		defer b.ps.wg.Done()
+		select {
+		case <-b.ps.clock.After(b.window):
+		case <-b.ps.quit:
+		}
+		b.flush(peer)
+	}()
+	return nil
+}
+
+// close makes the batcher refuse new replications. The queued ones are
+// flushed, failing once PushSync is closed.
+func (b *replicationBatcher) close() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.closed = true
+}
+
+// flush delivers the replications queued for the peer over a batch stream
+// and reports their results. The batch is delayed by the replication jitter
+// and has to be delivered within the neighbor push timeout.
+func (b *replicationBatcher) flush(peer swarm.Address) {
+	b.mtx.Lock()
+	queue := b.queues[peer.ByteString()]
+	delete(b.queues, peer.ByteString())
+	b.mtx.Unlock()
+
+	ctx, cancel := b.ps.withQuit(context.Background())
+	defer cancel()
+
+	chunks := make([]swarm.Chunk, 0, len(queue))
+	for _, r := range queue {
+		chunks = append(chunks, r.chunk)
+	}
+
+	var receipts []*Receipt
+	err := b.ps.waitReplicationJitter(ctx)
+	if err == nil {
+		ctx, cancel := b.ps.withTimeout(ctx, b.ps.neighborPushTimeout)
+		receipts, err = b.ps.pushBatch(ctx, peer, chunks)
+		cancel()
+		b.ps.metrics.TotalReplicationBatches.Inc()
+	}
+	for i, r := range queue {
+		if i < len(receipts) {
+			r.done(nil)
+			continue
+		}
+		if err == nil {
+			err = ErrNoReceipt
+		}
+		r.done(fmt.Errorf("batch replication to peer %s: %w", peer, err))
+	}
+}
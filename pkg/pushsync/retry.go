@@ -0,0 +1,113 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+	"github.com/ethersphere/bee/pkg/topology"
+)
+
+// RetryPolicy configures how PushChunkToClosestWithRetry retries pushes.
+type RetryPolicy struct {
+	// MaxAttempts is the maximal number of pushes of a chunk, including the
+	// first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It is doubled on every
+	// further retry.
+	BaseDelay time.Duration
+	// MaxDelay is the upper limit of the delay between retries.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy with three attempts and delays
+// between one and ten seconds.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Second,
+		MaxDelay:    10 * time.Second,
+	}
+}
+
+// delay returns the time to wait before the retry that follows the given
+// number of attempts.
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempts; i++ {
+		if d >= p.MaxDelay {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// PushChunkToClosestWithRetry pushes the chunk like PushChunkToClosest does,
+// but retries the whole push with exponential backoff if it fails. Pushes are
+// not retried if this node should store the chunk itself, if the context is
+// done or if PushSync is closed.
+func (ps *PushSync) PushChunkToClosestWithRetry(ctx context.Context, ch swarm.Chunk, policy RetryPolicy) (*Receipt, error) {
+	for attempts := 1; ; attempts++ {
+		receipt, err := ps.PushChunkToClosest(ctx, ch)
+		if err == nil {
+			return receipt, nil
+		}
+		if attempts >= policy.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return nil, err
+		}
+
+		ps.logger.Debugf("pushsync: retry push of chunk %s after attempt %d: %v", ch.Address(), attempts, err)
+
+		select {
+		case <-ps.clock.After(policy.delay(attempts)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ps.quit:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// retryable reports whether a failed push should be retried.
+func retryable(err error) bool {
+	return !errors.Is(err, topology.ErrWantSelf) && !errors.Is(err, ErrClosed)
+}
+
+// WithSamePeerRetries retries pushes to a peer up to n times on a new stream
+// if the stream fails while the delivery is written or the receipt is read,
+// before the peer is skipped and the next closest peer is tried.
+func WithSamePeerRetries(n int) Option {
+	return func(ps *PushSync) {
+		ps.samePeerRetries = n
+	}
+}
+
+// streamFailure is the error of a push to a peer whose stream failed while
+// the delivery was written or the receipt was read.
+type streamFailure struct {
+	err error
+}
+
+func (e *streamFailure) Error() string {
+	return e.err.Error()
+}
+
+func (e *streamFailure) Unwrap() error {
+	return e.err
+}
+
+// isStreamFailure reports whether the push error is a failure of the stream
+// to the peer, after which the push may succeed on a new stream.
+func isStreamFailure(err error) bool {
+	var sf *streamFailure
+	return errors.As(err, &sf)
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pushsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+	"github.com/ethersphere/bee/pkg/p2p/protobuf"
+	"github.com/ethersphere/bee/pkg/pushsync/pb"
+	"github.com/ethersphere/bee/pkg/swarm"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+var _ PushSyncer = (*StreamCachingPushSync)(nil)
+
+// StreamCachingPushSync is a PushSyncer for uploads of many chunks. It keeps
+// batch streams to the peers that chunks are pushed to open and delivers the
+// following chunks for the same peer over them, instead of opening a new
+// stream for every chunk. The price of every chunk is reserved and credited
+// the same way as for pushes over separate streams. Chunks that can not be
+// delivered over a cached stream are pushed with PushChunkToClosest of the
+// wrapped PushSync.
+//
+// Peers close streams that stay idle for longer than the request time to
+// live, in which case the stream is opened again on the next push.
+type StreamCachingPushSync struct {
+	ps      *PushSync
+	streams *lru.Cache // peer address byte string -> *cachedStream
+}
+
+// cachedStream is a batch stream to a peer. Deliveries over it are made one
+// at a time.
+type cachedStream struct {
+	mtx    sync.Mutex
+	stream p2p.Stream
+	w      protobuf.Writer
+	r      protobuf.Reader
+	closed bool
+}
+
+// NewStreamCachingPushSync returns a StreamCachingPushSync that keeps streams
+// to up to maxStreams peers open, closing the least recently used one when
+// the limit is reached. Values lower than 1 are treated as 1.
+func NewStreamCachingPushSync(ps *PushSync, maxStreams int) *StreamCachingPushSync {
+	if maxStreams < 1 {
+		maxStreams = 1
+	}
+	// not necessary to check error here as size is always positive
+	streams, _ := lru.NewWithEvict(maxStreams, func(_, value interface{}) {
+		// the evicted stream may be in use, so it is closed once its
+		// delivery is done, without holding the cache lock
+		go value.(*cachedStream).close()
+	})
+	return &StreamCachingPushSync{ps: ps, streams: streams}
+}
+
+// PushChunkToClosest pushes the chunk to the closest peer over a cached stream
+// and returns its receipt.
+func (s *StreamCachingPushSync) PushChunkToClosest(ctx context.Context, ch swarm.Chunk) (*Receipt, error) {
+	if s.ps.isClosed() {
+		return nil, ErrClosed
+	}
+
+	peer, err := s.ps.selectPeer(ch.Address(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, attempted, err := s.push(ctx, peer, ch)
+	if err != nil {
+		if attempted && ctx.Err() == nil {
+			s.ps.recordPushFailure(peer, ch.Address())
+		}
+		s.ps.logger.Debugf("pushsync: push over cached stream to peer %s: %v", peer, err)
+		return s.ps.PushChunkToClosest(ctx, ch)
+	}
+	s.ps.recordPushSuccess(peer, ch.Address())
+	return receipt, nil
+}
+
+// push delivers the chunk over the cached stream to the peer. If the cached
+// stream fails, the delivery is retried once over a new stream, as the peer
+// may have closed the stream while it was idle or it may have been evicted
+// from the cache. Only a failure over a new stream is reported as attempted,
+// so that the peer is not penalized for the closed cached stream.
+func (s *StreamCachingPushSync) push(ctx context.Context, peer swarm.Address, ch swarm.Chunk) (*Receipt, bool, error) {
+	ctx = withSentTagOnce(ctx)
+	for {
+		cs, cached, err := s.stream(ctx, peer)
+		if err != nil {
+			return nil, true, err
+		}
+
+		r, price, attempted, err := s.deliver(ctx, cs, peer, ch)
+		if err == nil {
+			receipt := newReceipt(r, peer, ch.Address(), price)
+			s.ps.callReceiptHook(ch.Address(), peer, receipt)
+			return receipt, true, nil
+		}
+		if !attempted {
+			// nothing was sent over the stream, which can be reused
+			return nil, false, err
+		}
+
+		s.remove(peer, cs)
+		if !cached {
+			return nil, true, err
+		}
+	}
+}
+
+// deliver delivers the chunk over the cached stream. A stream closed on
+// eviction is reported as an attempted delivery, so that push retries it
+// over a new stream.
+func (s *StreamCachingPushSync) deliver(ctx context.Context, cs *cachedStream, peer swarm.Address, ch swarm.Chunk) (*pb.ReceiptBundle, uint64, bool, error) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+
+	if cs.closed {
+		return nil, 0, true, fmt.Errorf("stream to peer %s closed", peer)
+	}
+	return s.ps.pushBatchChunk(ctx, cs.w, cs.r, peer, ch)
+}
+
+// stream returns the cached stream to the peer, or opens a new one. It also
+// reports whether the stream was taken from the cache.
+func (s *StreamCachingPushSync) stream(ctx context.Context, peer swarm.Address) (*cachedStream, bool, error) {
+	if v, ok := s.streams.Get(peer.ByteString()); ok {
+		return v.(*cachedStream), true, nil
+	}
+
+	stream, err := s.ps.streamer.NewStream(ctx, peer, makeHopsHeaders(ctx), protocolName, protocolVersion, batchStreamName)
+	if err != nil {
+		return nil, false, s.ps.newStreamError(peer, err)
+	}
+	cs := &cachedStream{
+		stream: stream,
+		w:      protobuf.NewWriter(stream),
+		r:      protobuf.NewReaderNamed(stream, "Receipt"),
+	}
+
+	// another push may have opened a stream to the same peer in the meantime
+	if v, ok, _ := s.streams.PeekOrAdd(peer.ByteString(), cs); ok {
+		_ = stream.Close()
+		return v.(*cachedStream), true, nil
+	}
+	return cs, false, nil
+}
+
+// remove resets the failed stream and removes it from the cache, unless it
+// was already replaced.
+func (s *StreamCachingPushSync) remove(peer swarm.Address, cs *cachedStream) {
+	cs.reset()
+	if v, ok := s.streams.Peek(peer.ByteString()); ok && v.(*cachedStream) == cs {
+		s.streams.Remove(peer.ByteString())
+	}
+}
+
+// Close closes all cached streams.
+func (s *StreamCachingPushSync) Close() error {
+	for _, key := range s.streams.Keys() {
+		if v, ok := s.streams.Peek(key); ok {
+			v.(*cachedStream).close()
+		}
+	}
+	s.streams.Purge()
+	return nil
+}
+
+// close closes the stream once the delivery in progress is done, letting the
+// peer know that no more chunks are delivered over it.
+func (cs *cachedStream) close() {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+
+	if cs.closed {
+		return
+	}
+	cs.closed = true
+	_ = cs.stream.Close()
+}
+
+// reset resets the stream after a failed delivery.
+func (cs *cachedStream) reset() {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+
+	if cs.closed {
+		return
+	}
+	cs.closed = true
+	_ = cs.stream.Reset()
+}
@@ -70,6 +70,11 @@ func (s *SOC) WrappedChunk() swarm.Chunk {
 	return s.chunk
 }
 
+// OwnerAddress returns the ethereum address of the SOC owner.
+func (s *SOC) OwnerAddress() []byte {
+	return s.owner
+}
+
 // Chunk returns the SOC chunk.
 func (s *SOC) Chunk() (swarm.Chunk, error) {
 	socAddress, err := s.address()
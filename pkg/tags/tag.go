@@ -42,22 +42,24 @@ var (
 type State = uint32
 
 const (
-	TotalChunks State = iota // The total no of chunks for the tag
-	StateSplit               // chunk has been processed by filehasher/swarm safe call
-	StateStored              // chunk stored locally
-	StateSeen                // chunk previously seen
-	StateSent                // chunk sent to neighbourhood
-	StateSynced              // proof is received; chunk removed from sync db; chunk is available everywhere
+	TotalChunks     State = iota // The total no of chunks for the tag
+	StateSplit                   // chunk has been processed by filehasher/swarm safe call
+	StateStored                  // chunk stored locally
+	StateSeen                    // chunk previously seen
+	StateSent                    // chunk sent to neighbourhood
+	StateSynced                  // proof is received; chunk removed from sync db; chunk is available everywhere
+	StateReplicated              // chunk replica accepted by a neighbour of the storer node
 )
 
 // Tag represents info on the status of new chunks
 type Tag struct {
-	Total  int64 // total chunks belonging to a tag
-	Split  int64 // number of chunks already processed by splitter for hashing
-	Seen   int64 // number of chunks already seen
-	Stored int64 // number of chunks already stored locally
-	Sent   int64 // number of chunks sent for push syncing
-	Synced int64 // number of chunks synced with proof
+	Total      int64 // total chunks belonging to a tag
+	Split      int64 // number of chunks already processed by splitter for hashing
+	Seen       int64 // number of chunks already seen
+	Stored     int64 // number of chunks already stored locally
+	Sent       int64 // number of chunks sent for push syncing
+	Synced     int64 // number of chunks synced with proof
+	Replicated int64 // number of chunk replicas accepted by neighbours, not persisted
 
 	Uid       uint32        // a unique identifier for this tag
 	Address   swarm.Address // the associated swarm hash for this tag
@@ -115,6 +117,8 @@ func (t *Tag) IncN(state State, n int64) error {
 		v = &t.Sent
 	case StateSynced:
 		v = &t.Synced
+	case StateReplicated:
+		v = &t.Replicated
 	}
 	atomic.AddInt64(v, n)
 
@@ -152,6 +156,8 @@ func (t *Tag) Get(state State) int64 {
 		v = &t.Sent
 	case StateSynced:
 		v = &t.Synced
+	case StateReplicated:
+		v = &t.Replicated
 	}
 	return atomic.LoadInt64(v)
 }
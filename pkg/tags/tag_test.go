@@ -49,6 +49,7 @@ func TestTagSingleIncrements(t *testing.T) {
 		{state: StateSeen, inc: 1, expcount: 1, exptotal: 10},
 		{state: StateSent, inc: 9, expcount: 9, exptotal: 9},
 		{state: StateSynced, inc: 9, expcount: 9, exptotal: 9},
+		{state: StateReplicated, inc: 27, expcount: 27, exptotal: 9},
 	}
 
 	for _, tc := range tc {
@@ -20,6 +20,7 @@ type mock struct {
 	addPeersErr     error
 	isWithinFunc    func(c swarm.Address) bool
 	marshalJSONFunc func() ([]byte, error)
+	depth           uint8
 	mtx             sync.Mutex
 }
 
@@ -59,6 +60,12 @@ func WithIsWithinFunc(f func(swarm.Address) bool) Option {
 	})
 }
 
+func WithNeighborhoodDepth(depth uint8) Option {
+	return optionFunc(func(d *mock) {
+		d.depth = depth
+	})
+}
+
 func NewTopologyDriver(opts ...Option) topology.Driver {
 	d := new(mock)
 	for _, o := range opts {
@@ -141,8 +148,8 @@ func (d *mock) SubscribePeersChange() (c <-chan struct{}, unsubscribe func()) {
 	return c, unsubscribe
 }
 
-func (*mock) NeighborhoodDepth() uint8 {
-	return 0
+func (d *mock) NeighborhoodDepth() uint8 {
+	return d.depth
 }
 
 func (m *mock) IsWithinDepth(addr swarm.Address) bool {